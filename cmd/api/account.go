@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	emailChangeTokenTTL   = time.Hour
+	passwordResetTokenTTL = 24 * time.Hour
+)
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveJSON(w, r, http.StatusOK, app.contextGetUser(r), nil)
+}
+
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// The email is changed through requestEmailChangeHandler, so the new address can be confirmed first
+	var input struct {
+		Name   *string `json:"name"`
+		Locale *string `json:"locale"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if input.Locale != nil {
+		user.Locale = data.CanonicalLocale(*input.Locale)
+	}
+
+	v := validator.New()
+
+	if user.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, user, nil)
+}
+
+// requestEmailChangeHandler sends a token to the new address, which confirmEmailChangeHandler
+// takes to change the user's email. The user's password is needed as well as their
+// authentication token, so a stolen token can't be used to take over the account.
+func (app *application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	v.Check(!strings.EqualFold(input.Email, user.Email), "email", "must be different to your current email address")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.enqueueJob(jobSendEmailChangeConfirmation, emailChangeJob{UserID: user.ID, Email: input.Email})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	message := "a confirmation token will be sent to " + input.Email
+
+	app.serveJSON(w, r, http.StatusAccepted, map[string]string{"message": message}, nil)
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, previousEmail, err := app.models.Users.ChangeEmail(input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// Another user registered or changed to the address after the token was sent
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.enqueueJob(jobSendEmailChangedNotice, emailChangedJob{UserID: user.ID, PreviousEmail: previousEmail})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, user, nil)
+}
+
+// changePasswordHandler sets a new password once the user has given their current one. Every
+// authentication token is revoked, so anyone else signed in as the user has to authenticate again.
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		Password        string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.CurrentPassword != "", "currentPassword", "must be provided")
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Tokens are revoked in the same transaction, so the old sessions can't outlive the old password
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		err := app.models.Users.UpdateTx(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeEmailChange} {
+			err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := "password successfully changed, please authenticate again"
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": message}, nil)
+}
+
+// resetPasswordHandler sets a new password for a user whose password was reset, taking the token
+// they were emailed in place of their current password
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The reset token is deleted in the same transaction, so it can only ever set one password
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		err := app.models.Users.UpdateTx(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopePasswordReset} {
+			err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "password successfully reset"}, nil)
+}
+
+// deleteCurrentUserHandler deletes the user's account once they've confirmed their password.
+// Their reviews, lists and webhooks are deleted with it, and the movie edits they made are kept
+// without saying who made them.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.Users.Delete(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "account successfully deleted"}, nil)
+}
+
+type emailChangeJob struct {
+	UserID int64  `json:"userId"`
+	Email  string `json:"email"`
+}
+
+// sendEmailChangeConfirmation sends a token to the address the user is changing their email to.
+// Like the activation token, it's only created when the email is sent.
+func (app *application) sendEmailChangeConfirmation(ctx context.Context, job emailChangeJob) error {
+	user, err := app.models.Users.Get(job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if strings.EqualFold(user.Email, job.Email) {
+		return nil
+	}
+
+	token, err := app.models.Tokens.NewEmailChange(user.ID, emailChangeTokenTTL, job.Email)
+	if err != nil {
+		return err
+	}
+
+	email := mailer.EmailChangeConfirmation{
+		Name:  user.Name,
+		Email: job.Email,
+		Token: token.Plaintext,
+	}
+
+	err = app.mailer.Send(ctx, job.Email, user.Locale, email)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("sent email change confirmation to user", map[string]string{"email": job.Email})
+
+	return nil
+}
+
+type emailChangedJob struct {
+	UserID        int64  `json:"userId"`
+	PreviousEmail string `json:"previousEmail"`
+}
+
+// sendEmailChangedNotice tells the user at their previous address that their email has changed,
+// so they find out if someone else changed it
+func (app *application) sendEmailChangedNotice(ctx context.Context, job emailChangedJob) error {
+	user, err := app.models.Users.Get(job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	email := mailer.EmailChanged{
+		Name:  user.Name,
+		Email: user.Email,
+	}
+
+	err = app.mailer.Send(ctx, job.PreviousEmail, user.Locale, email)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("sent email changed notice to user", map[string]string{"email": job.PreviousEmail})
+
+	return nil
+}
+
+type passwordResetJob struct {
+	UserID int64 `json:"userId"`
+}
+
+// sendPasswordReset sends a user whose password was reset the token for choosing a new one,
+// replacing any token they were sent before
+func (app *application) sendPasswordReset(ctx context.Context, job passwordResetJob) error {
+	user, err := app.models.Users.Get(job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, passwordResetTokenTTL, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	email := mailer.PasswordReset{
+		Name:  user.Name,
+		Token: token.Plaintext,
+	}
+
+	err = app.mailer.Send(ctx, user.Email, user.Locale, email)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("sent password reset to user", map[string]string{"email": user.Email})
+
+	return nil
+}
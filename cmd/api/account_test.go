@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokenRX = regexp.MustCompile(`\{"token": "([A-Z0-9]{26})"\}`)
+
+// sentToken returns the token in the last email sent to the recipient
+func sentToken(t *testing.T, transport *mailer.MemoryTransport, recipient string) string {
+	messages := transport.Messages()
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != recipient {
+			continue
+		}
+
+		match := tokenRX.FindStringSubmatch(messages[i].PlainBody)
+		if match == nil {
+			t.Fatalf("no token in the email sent to %s", recipient)
+		}
+
+		return match[1]
+	}
+
+	t.Fatalf("no email sent to %s", recipient)
+	return ""
+}
+
+func TestShowCurrentUser(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+
+	code, _, body := app.serveAs(t, testUser, "/v1/users/me", app.showCurrentUserHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+
+	var response struct {
+		Data map[string]any `json:"data"`
+	}
+
+	err := json.Unmarshal([]byte(body), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "alice@example.com", response.Data["email"])
+	assert.Equal(t, "en", response.Data["locale"])
+	assert.NotContains(t, response.Data, "password")
+}
+
+func TestConfirmEmailChangeValidatesToken(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/users/email", strings.NewReader(`{"token": "short"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rs.StatusCode)
+}
+
+func TestChangeEmail(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	transport := app.useMemoryMailer(t)
+
+	user := insertTestUser(t, app, "alice@example.com")
+
+	requestChange := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/me/email", strings.NewReader(body))
+		code, _, _ := app.serveAs(t, user, "/v1/users/me/email", app.requestEmailChangeHandler, r)
+		return code
+	}
+
+	confirmChange := func(token string) (int, string) {
+		r := httptest.NewRequest(http.MethodPut, "/v1/users/email", strings.NewReader(`{"token": "`+token+`"}`))
+		code, _, body := app.serveAs(t, user, "/v1/users/email", app.confirmEmailChangeHandler, r)
+		return code, body
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, requestChange(`{"email": "bob@example.com", "password": "wrong password"}`))
+	assert.Equal(t, http.StatusAccepted, requestChange(`{"email": "bob@example.com", "password": "pa55word1234"}`))
+
+	app.runQueuedJobs(t, jobSendEmailChangeConfirmation)
+	token := sentToken(t, transport, "bob@example.com")
+
+	// Someone else takes the address before the token is used
+	insertTestUser(t, app, "bob@example.com")
+
+	code, body := confirmChange(token)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.JSONEq(t, createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"email": "a user with this email address already exists"},
+	}), body)
+
+	assert.Equal(t, http.StatusAccepted, requestChange(`{"email": "carol@example.com", "password": "pa55word1234"}`))
+
+	app.runQueuedJobs(t, jobSendEmailChangeConfirmation)
+	token = sentToken(t, transport, "carol@example.com")
+
+	code, _ = confirmChange(token)
+
+	assert.Equal(t, http.StatusOK, code)
+
+	changed, err := app.models.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "carol@example.com", changed.Email)
+
+	// The token can only be used once
+	code, _ = confirmChange(token)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	app.runQueuedJobs(t, jobSendEmailChangedNotice)
+
+	messages := transport.Messages()
+	if assert.NotEmpty(t, messages) {
+		notice := messages[len(messages)-1]
+
+		assert.Equal(t, "alice@example.com", notice.To)
+		assert.Contains(t, notice.PlainBody, "carol@example.com")
+	}
+}
+
+func TestChangePasswordRevokesTokens(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+
+	user := insertTestUser(t, app, "alice@example.com")
+
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changePassword := func(user *data.User, body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/v1/users/me/password", strings.NewReader(body))
+		code, _, _ := app.serveAs(t, user, "/v1/users/me/password", app.changePasswordHandler, r)
+		return code
+	}
+
+	// A change made with an out of date copy of the user isn't saved, and nothing is revoked
+	stale := *user
+	stale.Version--
+
+	assert.Equal(t, http.StatusConflict, changePassword(&stale, `{"currentPassword": "pa55word1234", "password": "n3wpa55word1234"}`))
+
+	_, err = app.models.Users.GetForToken(data.ScopeAuthentication, token.Plaintext)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, changePassword(user, `{"currentPassword": "pa55word1234", "password": "n3wpa55word1234"}`))
+
+	_, err = app.models.Users.GetForToken(data.ScopeAuthentication, token.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	changed, err := app.models.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := changed.Password.Matches("n3wpa55word1234")
+	assert.NoError(t, err)
+	assert.True(t, match)
+}
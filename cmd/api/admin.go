@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search    string
+		Activated string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "search", "")
+	input.Activated = app.readString(qs, "activated", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	v.Check(validator.PermittedValue(input.Activated, "", "true", "false"), "activated", "must be true or false")
+
+	if input.Filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var activated *bool
+	if input.Activated != "" {
+		value := input.Activated == "true"
+		activated = &value
+	}
+
+	users, pageInfo, err := app.models.Users.GetAll(input.Search, activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"users": users, "pageInfo": pageInfo}, nil)
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"user": user, "permissions": permissions}, nil)
+}
+
+// setUserActivatedHandler returns a handler that activates or deactivates the user. Deactivated
+// users are signed out, and while they can authenticate again, they can't use anything that
+// needs an activated account.
+func (app *application) setUserActivatedHandler(activated bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if user.Activated == activated {
+			app.serveJSON(w, r, http.StatusOK, user, nil)
+			return
+		}
+
+		err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+			if !activated {
+				user.Activated = false
+
+				err := app.models.Users.UpdateTx(ctx, tx, user)
+				if err != nil {
+					return err
+				}
+
+				err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, data.ScopeAuthentication, user.ID)
+				if err != nil {
+					return err
+				}
+
+				return app.audit(ctx, tx, r, data.AuditUserDeactivated, user, nil)
+			}
+
+			err := app.models.Users.ActivateTx(ctx, tx, user)
+			if err != nil {
+				return err
+			}
+
+			err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, data.ScopeActivation, user.ID)
+			if err != nil {
+				return err
+			}
+
+			return app.audit(ctx, tx, r, data.AuditUserActivated, user, nil)
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.serveJSON(w, r, http.StatusOK, user, nil)
+	}
+}
+
+// resetUserPasswordHandler replaces the user's password with a random one and signs them out
+// everywhere, then emails them a token for choosing a new password
+func (app *application) resetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Invalidate()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The reset email is queued with the new password, so the user is never left without a way back in
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		err := app.models.Users.UpdateTx(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+
+		err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, data.ScopeAuthentication, user.ID)
+		if err != nil {
+			return err
+		}
+
+		err = app.enqueueJobTx(ctx, tx, jobSendPasswordReset, passwordResetJob{UserID: user.ID})
+		if err != nil {
+			return err
+		}
+
+		return app.audit(ctx, tx, r, data.AuditPasswordReset, user, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := "password successfully reset, a password reset token will be sent to " + user.Email
+
+	app.serveJSON(w, r, http.StatusAccepted, map[string]string{"message": message}, nil)
+}
+
+func (app *application) revokeUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		for _, scope := range data.TokenScopes {
+			err := app.models.Tokens.DeleteAllForUserTx(ctx, tx, scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return app.audit(ctx, tx, r, data.AuditTokensRevoked, user, nil)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "tokens successfully revoked"}, nil)
+}
+
+// updateUserPermissionsHandler replaces the user's permissions. Admins can't take away their own
+// users:manage permission, so there's always someone left who can give it back.
+func (app *application) updateUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions data.Permissions `json:"permissions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+
+	for _, code := range input.Permissions {
+		v.Check(validator.PermittedValue(code, data.PermissionCodes...), "permissions", fmt.Sprintf("unknown permission %q", code))
+	}
+
+	if id == app.contextGetUser(r).ID {
+		v.Check(input.Permissions.Include(data.PermissionUsersManage), "permissions", "must not remove your own users:manage permission")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		// Read in the transaction, so the audit entry shows what was actually replaced
+		previous, err := app.models.Permissions.GetAllForUserTx(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if previous == nil {
+			previous = data.Permissions{}
+		}
+
+		err = app.models.Permissions.SetForUserTx(ctx, tx, user.ID, input.Permissions...)
+		if err != nil {
+			return err
+		}
+
+		return app.audit(ctx, tx, r, data.AuditPermissionsChanged, user, map[string]any{
+			"before": previous,
+			"after":  input.Permissions,
+		})
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"user": user, "permissions": input.Permissions}, nil)
+}
+
+func (app *application) listAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.UserID = app.readInt(qs, "user_id", 0, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-id"
+	input.Filters.SortSafeList = []string{"-id"}
+
+	v.Check(input.UserID >= 0, "user_id", "must not be negative")
+
+	if input.Filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, pageInfo, err := app.models.Audit.GetAll(int64(input.UserID), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"entries": entries, "pageInfo": pageInfo}, nil)
+}
+
+// audit records the action the authenticated admin took on the user, in the transaction making
+// the change. The user's email is always recorded, so entries still say who the user was once
+// they've been deleted.
+func (app *application) audit(ctx context.Context, tx *sql.Tx, r *http.Request, action string, user *data.User, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+
+	details["email"] = user.Email
+
+	return app.models.Audit.InsertTx(ctx, tx, app.contextGetUser(r).ID, action, user.ID, details)
+}
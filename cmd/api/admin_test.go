@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateUserPermissionsKeepsOwnUsersManage(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/admin/users/1/permissions", strings.NewReader(`{"permissions": ["movies:write"]}`))
+
+	code, _, body := app.serveAs(t, testUser, "/v1/admin/users/:id/permissions", app.updateUserPermissionsHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.JSONEq(t, createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"permissions": "must not remove your own users:manage permission"},
+	}), body)
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	app.useMemoryMailer(t)
+
+	admin := insertTestUser(t, app, "admin@example.com", data.PermissionUsersManage)
+	user := insertTestUser(t, app, "bob@example.com", data.PermissionMoviesWrite)
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/admin/users/2/permissions", strings.NewReader(`{"permissions": ["movies:export"]}`))
+	code, _, _ := app.serveAs(t, admin, "/v1/admin/users/:id/permissions", app.updateUserPermissionsHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, data.Permissions{data.PermissionMoviesExport}, permissions)
+
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/admin/users/2/deactivate", nil)
+	code, _, _ = app.serveAs(t, admin, "/v1/admin/users/:id/deactivate", app.setUserActivatedHandler(false), r)
+
+	assert.Equal(t, http.StatusOK, code)
+
+	// Deactivating the user signs them out
+	_, err = app.models.Users.GetForToken(data.ScopeAuthentication, token.Plaintext)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/admin/users/2/password-reset", nil)
+	code, _, _ = app.serveAs(t, admin, "/v1/admin/users/:id/password-reset", app.resetUserPasswordHandler, r)
+
+	assert.Equal(t, http.StatusAccepted, code)
+
+	// The previous password no longer works
+	reset, err := app.models.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := reset.Password.Matches("pa55word1234")
+	assert.NoError(t, err)
+	assert.False(t, match)
+	assert.False(t, reset.Activated)
+
+	entries, _, err := app.models.Audit.GetAll(user.ID, data.Filters{Page: 1, PageSize: 20, Sort: "-id", SortSafeList: []string{"-id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, data.AuditPasswordReset, entries[0].Action)
+		assert.Equal(t, data.AuditUserDeactivated, entries[1].Action)
+		assert.Equal(t, data.AuditPermissionsChanged, entries[2].Action)
+
+		assert.Equal(t, &admin.ID, entries[2].ActorID)
+		assert.Equal(t, map[string]any{
+			"email":  "bob@example.com",
+			"before": []any{"movies:write"},
+			"after":  []any{"movies:export"},
+		}, entries[2].Details)
+	}
+
+	// Entries say who the user was once they've been deleted
+	err = app.models.Users.Delete(reset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err = app.models.Audit.GetAll(0, data.Filters{Page: 1, PageSize: 20, Sort: "-id", SortSafeList: []string{"-id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, entries, 3) {
+		assert.Nil(t, entries[0].UserID)
+		assert.Equal(t, "bob@example.com", entries[0].Details["email"])
+	}
+}
+
+func TestAdminActionsAreOnlyMadeIfAudited(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+
+	user := insertTestUser(t, app, "bob@example.com")
+
+	// The audit entry can't be written for an admin who doesn't exist, which rolls the action back
+	admin := &data.User{ID: 99, Email: "admin@example.com", Activated: true}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/users/1/password-reset", nil)
+	code, _, _ := app.serveAs(t, admin, "/v1/admin/users/:id/password-reset", app.resetUserPasswordHandler, r)
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/admin/users/1/deactivate", nil)
+	code, _, _ = app.serveAs(t, admin, "/v1/admin/users/:id/deactivate", app.setUserActivatedHandler(false), r)
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	unchanged, err := app.models.Users.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := unchanged.Password.Matches("pa55word1234")
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, unchanged.Activated)
+
+	_, err = app.models.Jobs.Claim(jobSendPasswordReset, time.Minute)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	entries, _, err := app.models.Audit.GetAll(0, data.Filters{Page: 1, PageSize: 20, Sort: "-id", SortSafeList: []string{"-id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, entries)
+}
+
+func TestResetPassword(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	transport := app.useMemoryMailer(t)
+
+	admin := insertTestUser(t, app, "admin@example.com", data.PermissionUsersManage)
+	insertTestUser(t, app, "bob@example.com")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/users/2/password-reset", nil)
+	code, _, _ := app.serveAs(t, admin, "/v1/admin/users/:id/password-reset", app.resetUserPasswordHandler, r)
+
+	assert.Equal(t, http.StatusAccepted, code)
+
+	app.runQueuedJobs(t, jobSendPasswordReset)
+	token := sentToken(t, transport, "bob@example.com")
+
+	resetPassword := func() int {
+		body := strings.NewReader(`{"password": "n3wpa55word1234", "token": "` + token + `"}`)
+		r := httptest.NewRequest(http.MethodPut, "/v1/users/password", body)
+		code, _, _ := app.serveAs(t, data.AnonymousUser, "/v1/users/password", app.resetPasswordHandler, r)
+		return code
+	}
+
+	assert.Equal(t, http.StatusOK, resetPassword())
+
+	reset, err := app.models.Users.GetByEmail("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := reset.Password.Matches("n3wpa55word1234")
+	assert.NoError(t, err)
+	assert.True(t, match)
+
+	// The token is deleted along with setting the password, so it can't be used again
+	assert.Equal(t, http.StatusUnprocessableEntity, resetPassword())
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	maxBulkMovies    = 1000
+	maxBulkBodyBytes = 10 * 1_048_576
+)
+
+const (
+	bulkStatusCreated = "created"
+	bulkStatusInvalid = "invalid"
+	// Valid movies aren't created when others in the request are invalid, unless in partial mode
+	bulkStatusSkipped = "skipped"
+)
+
+type bulkMovieResult struct {
+	Index  int               `json:"index"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// errTooManyBulkItems is returned by readBulkItems once the body has more than maxBulkMovies items
+var errTooManyBulkItems = fmt.Errorf("must not contain more than %d movies", maxBulkMovies)
+
+func (app *application) createMoviesBulkHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	partial := app.readBool(r.URL.Query(), "partial", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results := []bulkMovieResult{}
+	movies := []*data.Movie{}
+	// The index into results of each valid movie
+	resultIndexes := []int{}
+
+	// Each item is validated as it's read, so only the movies are kept rather than the whole body
+	err := app.readBulkItems(w, r, func(item json.RawMessage) {
+		i := len(results)
+		results = append(results, bulkMovieResult{Index: i})
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+
+		err := decodeBulkItem(item, &input)
+		if err != nil {
+			results[i].Status = bulkStatusInvalid
+			results[i].Errors = map[string]string{"body": err.Error()}
+			return
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+
+		itemValidator := validator.New()
+
+		app.normalizeGenres(movie, itemValidator)
+
+		if movie.Validate(itemValidator); !itemValidator.Valid() {
+			results[i].Status = bulkStatusInvalid
+			results[i].Errors = itemValidator.Errors
+			return
+		}
+
+		movies = append(movies, movie)
+		resultIndexes = append(resultIndexes, i)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errTooManyBulkItems):
+			v.AddError("movies", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	if v.Check(len(results) > 0, "movies", "must contain at least 1 movie"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invalid := len(results) - len(movies)
+
+	if len(movies) == 0 || (invalid > 0 && !partial) {
+		for _, i := range resultIndexes {
+			results[i].Status = bulkStatusSkipped
+		}
+
+		data := map[string]any{"results": results, "created": 0, "invalid": invalid}
+		app.serveJSON(w, r, http.StatusUnprocessableEntity, data, nil)
+		return
+	}
+
+	err = app.models.Movies.InsertMany(movies, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for j, i := range resultIndexes {
+		results[i].Status = bulkStatusCreated
+		results[i].ID = movies[j].ID
+	}
+
+	status := http.StatusCreated
+	if invalid > 0 {
+		status = http.StatusOK
+	}
+
+	data := map[string]any{"results": results, "created": len(movies), "invalid": invalid}
+
+	app.serveJSON(w, r, status, data, nil)
+}
+
+// readBulkItems streams the items of either a JSON array or, when sent as application/x-ndjson,
+// newline delimited JSON, passing each to process as soon as it's read. Items are passed undecoded
+// so that each can be validated separately.
+func (app *application) readBulkItems(w http.ResponseWriter, r *http.Request, process func(item json.RawMessage)) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
+
+	count := 0
+
+	next := func(item json.RawMessage) error {
+		count++
+		if count > maxBulkMovies {
+			return errTooManyBulkItems
+		}
+
+		process(item)
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/x-ndjson" {
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			// The scanner reuses its buffer, but items are decoded before the next line is read
+			err := next(line)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return errors.New("body contains a line larger than 1048576 bytes")
+			}
+			return translateJSONError(err)
+		}
+
+		return nil
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return translateJSONError(err)
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("body must contain a JSON array")
+	}
+
+	for decoder.More() {
+		var item json.RawMessage
+
+		err := decoder.Decode(&item)
+		if err != nil {
+			return translateJSONError(err)
+		}
+
+		err = next(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The closing bracket of the array
+	_, err = decoder.Token()
+	if err != nil {
+		return translateJSONError(err)
+	}
+
+	err = decoder.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+func decodeBulkItem(item json.RawMessage, input any) error {
+	decoder := json.NewDecoder(bytes.NewReader(item))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(input)
+	if err != nil {
+		return translateJSONError(err)
+	}
+
+	return nil
+}
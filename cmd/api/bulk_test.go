@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMoviesBulkReportsEachInvalidItem(t *testing.T) {
+	app := newTestApplication(t)
+
+	body := strings.Join([]string{
+		`{"title": "Moana", "year": 2016, "runtime": "107 mins"}`,
+		`{"title": "Black Panther", "year": 2018, "runtime": "134 mins", "genres": ["action"], "plot": "?"}`,
+		`{not json}`,
+	}, "\n")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+
+	code, _, responseBody := app.serveAs(t, testUser, "/v1/movies/bulk", app.createMoviesBulkHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"created": 0,
+		"invalid": 3,
+		"results": []map[string]any{
+			{
+				"index":  0,
+				"status": "invalid",
+				"errors": map[string]string{"genres": "must be provided"},
+			},
+			{
+				"index":  1,
+				"status": "invalid",
+				"errors": map[string]string{"body": `body contains unkown key "plot"`},
+			},
+			{
+				"index":  2,
+				"status": "invalid",
+				"errors": map[string]string{"body": "body contains badly-formed JSON (at character 2)"},
+			},
+		},
+	})
+
+	assert.JSONEq(t, expected_body, responseBody)
+}
+
+func TestCreateMoviesBulkStopsReadingAfterMaxItems(t *testing.T) {
+	app := newTestApplication(t)
+
+	body := strings.Repeat("{}\n", maxBulkMovies+1)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+
+	code, _, responseBody := app.serveAs(t, testUser, "/v1/movies/bulk", app.createMoviesBulkHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"movies": "must not contain more than 1000 movies"},
+	})
+
+	assert.JSONEq(t, expected_body, responseBody)
+}
+
+func TestCreateMoviesBulkStreamsJSONArray(t *testing.T) {
+	app := newTestApplication(t)
+
+	body := `[{"title": "Moana", "year": 2016, "runtime": "107 mins"}, {"year": 2018}]`
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	code, _, responseBody := app.serveAs(t, testUser, "/v1/movies/bulk", app.createMoviesBulkHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Contains(t, responseBody, `"invalid":2`)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/movies/bulk", strings.NewReader(`{"title": "Moana"}`))
+
+	code, _, responseBody = app.serveAs(t, testUser, "/v1/movies/bulk", app.createMoviesBulkHandler, r)
+
+	assert.Equal(t, http.StatusBadRequest, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusBadRequest, map[string]any{
+		"error": "body must contain a JSON array",
+	})
+
+	assert.JSONEq(t, expected_body, responseBody)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type db struct {
@@ -29,12 +31,64 @@ type smtp struct {
 	sender   string
 }
 
+const (
+	mailTransportSMTP   = "smtp"
+	mailTransportDir    = "dir"
+	mailTransportLog    = "log"
+	mailTransportMemory = "memory"
+)
+
+type mail struct {
+	// transport is how emails are delivered, the SMTP settings are only used by the smtp transport
+	transport string
+	dir       string
+}
+
+type healthcheck struct {
+	timeout    time.Duration
+	checkSMTP  bool
+	drainDelay time.Duration
+}
+
+type search struct {
+	similarityThreshold float64
+}
+
+type trash struct {
+	retention     time.Duration
+	purgeInterval time.Duration
+}
+
+type jobs struct {
+	pollInterval time.Duration
+}
+
+type webhooks struct {
+	workers        int
+	pollInterval   time.Duration
+	timeout        time.Duration
+	maxAttempts    int
+	eventRetention time.Duration
+}
+
+type blobStorage struct {
+	dir string
+}
+
 type config struct {
-	port    int
-	env     string
-	db      *db
-	limiter *limiter
-	smtp    *smtp
+	port         int
+	env          string
+	db           *db
+	limiter      *limiter
+	smtp         *smtp
+	mail         *mail
+	healthcheck  *healthcheck
+	search       *search
+	trash        *trash
+	jobs         *jobs
+	webhooks     *webhooks
+	storage      *blobStorage
+	cursorSecret []byte
 }
 
 func NewConfig() (*config, error) {
@@ -62,27 +116,72 @@ func NewConfig() (*config, error) {
 		return nil, err
 	}
 
+	mail, err := getMailConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	healthcheck, err := getHealthcheckConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	search, err := getSearchConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	trash, err := getTrashConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := getJobsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := getWebhooksConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	blobStorage := &blobStorage{
+		dir: getOptionalStringEnv("STORAGE_DIR", "storage"),
+	}
+
+	cursorSecret, err := getCursorSecret()
+	if err != nil {
+		return nil, err
+	}
+
 	c := &config{
-		env:     os.Getenv("API_ENV"),
-		port:    int(port),
-		db:      db,
-		limiter: limiter,
-		smtp:    smtp,
+		env:          os.Getenv("API_ENV"),
+		port:         int(port),
+		db:           db,
+		limiter:      limiter,
+		smtp:         smtp,
+		mail:         mail,
+		healthcheck:  healthcheck,
+		search:       search,
+		trash:        trash,
+		jobs:         jobs,
+		webhooks:     webhooks,
+		storage:      blobStorage,
+		cursorSecret: cursorSecret,
 	}
 
 	return c, nil
 }
 
 func ensureRequiredConfigProvided() error {
-	requiredEnvVars := [8]string{
+	requiredEnvVars := [6]string{
 		"API_PORT",
 		"API_ENV",
 		"POSTGRES_USER",
 		"POSTGRES_PASSWORD",
 		"POSTGRES_PORT",
 		"POSTGRES_DB",
-		"SMTP_USERNAME",
-		"SMTP_PASSWORD",
 	}
 
 	missingVars := []string{}
@@ -187,6 +286,192 @@ func getSMTPConfig() (*smtp, error) {
 	return smtp, nil
 }
 
+func getMailConfig() (*mail, error) {
+	transport := getOptionalStringEnv("MAIL_TRANSPORT", mailTransportSMTP)
+
+	switch transport {
+	case mailTransportSMTP:
+		// SMTP credentials are only required when emails are actually sent over SMTP
+		for _, env := range []string{"SMTP_USERNAME", "SMTP_PASSWORD"} {
+			if _, ok := os.LookupEnv(env); !ok {
+				return nil, fmt.Errorf("%s must be provided when MAIL_TRANSPORT is smtp", env)
+			}
+		}
+	case mailTransportDir, mailTransportLog, mailTransportMemory:
+	default:
+		return nil, errors.New("MAIL_TRANSPORT must be one of smtp, dir, log or memory")
+	}
+
+	mail := &mail{
+		transport: transport,
+		dir:       getOptionalStringEnv("MAIL_DIR", "mail"),
+	}
+
+	return mail, nil
+}
+
+func getHealthcheckConfig() (*healthcheck, error) {
+	timeout, err := getOptionalIntEnv("HEALTHCHECK_TIMEOUT_SECS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time given to load balancers to notice the failing readiness probe before
+	// the server stops accepting new connections.
+	drainDelay, err := getOptionalIntEnv("SHUTDOWN_DRAIN_SECS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	checkSMTP, err := getOptionalBoolEnv("HEALTHCHECK_SMTP", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without any time to respond every dependency would be reported as down
+	if timeout < 1 {
+		return nil, errors.New("HEALTHCHECK_TIMEOUT_SECS must be at least 1")
+	}
+
+	healthcheck := &healthcheck{
+		timeout:    time.Duration(timeout) * time.Second,
+		checkSMTP:  checkSMTP,
+		drainDelay: time.Duration(drainDelay) * time.Second,
+	}
+
+	return healthcheck, nil
+}
+
+func getSearchConfig() (*search, error) {
+	similarityThreshold, err := getOptionalFloat64Env("SEARCH_SIMILARITY_THRESHOLD", 0.3)
+	if err != nil {
+		return nil, err
+	}
+
+	if similarityThreshold <= 0 || similarityThreshold > 1 {
+		return nil, errors.New("SEARCH_SIMILARITY_THRESHOLD must be greater than 0 and at most 1")
+	}
+
+	search := &search{
+		similarityThreshold: similarityThreshold,
+	}
+
+	return search, nil
+}
+
+func getTrashConfig() (*trash, error) {
+	retentionDays, err := getOptionalIntEnv("TRASH_RETENTION_DAYS", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	purgeIntervalMins, err := getOptionalIntEnv("TRASH_PURGE_INTERVAL_MINS", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	if retentionDays < 0 {
+		return nil, errors.New("TRASH_RETENTION_DAYS must not be negative")
+	}
+
+	if purgeIntervalMins < 1 {
+		return nil, errors.New("TRASH_PURGE_INTERVAL_MINS must be at least 1")
+	}
+
+	trash := &trash{
+		retention:     time.Duration(retentionDays) * 24 * time.Hour,
+		purgeInterval: time.Duration(purgeIntervalMins) * time.Minute,
+	}
+
+	return trash, nil
+}
+
+func getJobsConfig() (*jobs, error) {
+	pollIntervalSecs, err := getOptionalIntEnv("JOB_POLL_INTERVAL_SECS", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if pollIntervalSecs < 1 {
+		return nil, errors.New("JOB_POLL_INTERVAL_SECS must be at least 1")
+	}
+
+	jobs := &jobs{
+		pollInterval: time.Duration(pollIntervalSecs) * time.Second,
+	}
+
+	return jobs, nil
+}
+
+func getWebhooksConfig() (*webhooks, error) {
+	workers, err := getOptionalIntEnv("WEBHOOK_WORKERS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	pollIntervalSecs, err := getOptionalIntEnv("WEBHOOK_POLL_INTERVAL_SECS", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutSecs, err := getOptionalIntEnv("WEBHOOK_TIMEOUT_SECS", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttempts, err := getOptionalIntEnv("WEBHOOK_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	eventRetentionDays, err := getOptionalIntEnv("WEBHOOK_EVENT_RETENTION_DAYS", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	if workers < 1 || maxAttempts < 1 {
+		return nil, errors.New("WEBHOOK_WORKERS and WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+
+	// A zero timeout would let requests hang forever and give claimed deliveries no lease
+	if pollIntervalSecs < 1 || timeoutSecs < 1 {
+		return nil, errors.New("WEBHOOK_POLL_INTERVAL_SECS and WEBHOOK_TIMEOUT_SECS must be at least 1")
+	}
+
+	// Deliveries are listed for a while after they're sent, so users can see what happened
+	if eventRetentionDays < 1 {
+		return nil, errors.New("WEBHOOK_EVENT_RETENTION_DAYS must be at least 1")
+	}
+
+	webhooks := &webhooks{
+		workers:        workers,
+		pollInterval:   time.Duration(pollIntervalSecs) * time.Second,
+		timeout:        time.Duration(timeoutSecs) * time.Second,
+		maxAttempts:    maxAttempts,
+		eventRetention: time.Duration(eventRetentionDays) * 24 * time.Hour,
+	}
+
+	return webhooks, nil
+}
+
+// getCursorSecret returns the key used to sign pagination cursors. If one isn't configured
+// a random key is used, meaning cursors won't survive a restart or work across instances.
+func getCursorSecret() ([]byte, error) {
+	secret := os.Getenv("CURSOR_SECRET")
+	if secret != "" {
+		return []byte(secret), nil
+	}
+
+	randomSecret := make([]byte, 32)
+
+	_, err := rand.Read(randomSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return randomSecret, nil
+}
+
 func getOptionalIntEnv(key string, defaultValue int) (int, error) {
 	env := os.Getenv(key)
 	if env == "" {
@@ -209,13 +494,26 @@ func getOptionalStringEnv(key, defaultValue string) string {
 	return env
 }
 
+func getOptionalBoolEnv(key string, defaultValue bool) (bool, error) {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "":
+		return defaultValue, nil
+	case "true", "t":
+		return true, nil
+	case "false", "f":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+}
+
 func getOptionalFloat64Env(key string, defaultValue float64) (float64, error) {
 	env := os.Getenv(key)
 	if env == "" {
 		return defaultValue, nil
 	}
 
-	parsedFloat, err := strconv.ParseFloat(key, 64)
+	parsedFloat, err := strconv.ParseFloat(env, 64)
 	if err != nil {
 		return 0.0, err
 	}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTrashConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		retentionDays string
+		intervalMins  string
+		want          *trash
+		wantErr       string
+	}{
+		{name: "defaults", want: &trash{retention: 30 * 24 * time.Hour, purgeInterval: time.Hour}},
+		{name: "no retention", retentionDays: "0", intervalMins: "5", want: &trash{retention: 0, purgeInterval: 5 * time.Minute}},
+		{name: "negative retention", retentionDays: "-1", wantErr: "TRASH_RETENTION_DAYS must not be negative"},
+		{name: "zero interval", intervalMins: "0", wantErr: "TRASH_PURGE_INTERVAL_MINS must be at least 1"},
+		{name: "negative interval", intervalMins: "-5", wantErr: "TRASH_PURGE_INTERVAL_MINS must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRASH_RETENTION_DAYS", tt.retentionDays)
+			t.Setenv("TRASH_PURGE_INTERVAL_MINS", tt.intervalMins)
+
+			trash, err := getTrashConfig()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, trash)
+		})
+	}
+}
+
+func TestGetWebhooksConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		pollInterval   string
+		timeout        string
+		eventRetention string
+		wantErr        string
+	}{
+		{name: "defaults"},
+		{name: "zero poll interval", pollInterval: "0", wantErr: "WEBHOOK_POLL_INTERVAL_SECS and WEBHOOK_TIMEOUT_SECS must be at least 1"},
+		{name: "negative poll interval", pollInterval: "-1", wantErr: "WEBHOOK_POLL_INTERVAL_SECS and WEBHOOK_TIMEOUT_SECS must be at least 1"},
+		{name: "zero timeout", timeout: "0", wantErr: "WEBHOOK_POLL_INTERVAL_SECS and WEBHOOK_TIMEOUT_SECS must be at least 1"},
+		{name: "zero event retention", eventRetention: "0", wantErr: "WEBHOOK_EVENT_RETENTION_DAYS must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEBHOOK_POLL_INTERVAL_SECS", tt.pollInterval)
+			t.Setenv("WEBHOOK_TIMEOUT_SECS", tt.timeout)
+			t.Setenv("WEBHOOK_EVENT_RETENTION_DAYS", tt.eventRetention)
+
+			config, err := getWebhooksConfig()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			want := &webhooks{workers: 2, pollInterval: time.Second, timeout: 10 * time.Second, maxAttempts: 8, eventRetention: 30 * 24 * time.Hour}
+			assert.Equal(t, want, config)
+		})
+	}
+}
+
+func TestGetJobsConfig(t *testing.T) {
+	t.Setenv("JOB_POLL_INTERVAL_SECS", "")
+
+	config, err := getJobsConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, &jobs{pollInterval: time.Second}, config)
+
+	for _, interval := range []string{"0", "-1"} {
+		t.Setenv("JOB_POLL_INTERVAL_SECS", interval)
+
+		_, err := getJobsConfig()
+
+		assert.EqualError(t, err, "JOB_POLL_INTERVAL_SECS must be at least 1")
+	}
+}
+
+func TestGetHealthcheckConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   string
+		checkSMTP string
+		want      *healthcheck
+		wantErr   string
+	}{
+		{name: "defaults", want: &healthcheck{timeout: 2 * time.Second}},
+		{name: "smtp", timeout: "5", checkSMTP: "TRUE", want: &healthcheck{timeout: 5 * time.Second, checkSMTP: true}},
+		{name: "zero timeout", timeout: "0", wantErr: "HEALTHCHECK_TIMEOUT_SECS must be at least 1"},
+		{name: "negative timeout", timeout: "-2", wantErr: "HEALTHCHECK_TIMEOUT_SECS must be at least 1"},
+		{name: "invalid smtp", checkSMTP: "yes", wantErr: "HEALTHCHECK_SMTP must be true or false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HEALTHCHECK_TIMEOUT_SECS", tt.timeout)
+			t.Setenv("HEALTHCHECK_SMTP", tt.checkSMTP)
+			t.Setenv("SHUTDOWN_DRAIN_SECS", "")
+
+			config, err := getHealthcheckConfig()
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, config)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser should only be called when we expect there to be a user in the context,
+// which is the case for every request handled after the authenticate middleware
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
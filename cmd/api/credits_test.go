@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreditValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		credit data.Credit
+		want   map[string]string
+	}{
+		{name: "actor", credit: data.Credit{PersonID: 1, Role: "actor", Character: "Ripley"}, want: map[string]string{}},
+		{name: "director", credit: data.Credit{PersonID: 1, Role: "director"}, want: map[string]string{}},
+		{name: "actor without character", credit: data.Credit{PersonID: 1, Role: "actor"}, want: map[string]string{"character": "must be provided for an actor"}},
+		{name: "director with character", credit: data.Credit{PersonID: 1, Role: "director", Character: "Ripley"}, want: map[string]string{"character": "must only be provided for an actor"}},
+		{name: "unknown role", credit: data.Credit{PersonID: 1, Role: "producer"}, want: map[string]string{"role": "must be one of director, writer or actor"}},
+		{name: "no person", credit: data.Credit{Role: "writer"}, want: map[string]string{"personId": "must be provided"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			tt.credit.Validate(v)
+
+			assert.Equal(t, tt.want, v.Errors)
+		})
+	}
+}
+
+func TestMovieCredits(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"science-fiction"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := &data.Person{Name: "Sigourney Weaver", BirthYear: 1949}
+
+	err = app.models.People.Insert(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createCredit := func(body string) (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies/1/credits", strings.NewReader(body))
+		code, _, responseBody := app.serveAs(t, user, "/v1/movies/:id/credits", app.createMovieCreditHandler, r)
+		return code, responseBody
+	}
+
+	code, body := createCredit(`{"personId": 1, "role": "actor", "character": "Ripley"}`)
+
+	assert.Equal(t, http.StatusCreated, code)
+	assert.JSONEq(t, createExpectedBodyResponse(t, http.StatusCreated, map[string]any{
+		"id": 1, "movieId": 1, "personId": 1, "name": "Sigourney Weaver", "role": "actor", "character": "Ripley",
+	}), body)
+
+	code, body = createCredit(`{"personId": 1, "role": "actor", "character": "Ripley"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Contains(t, body, "this person is already credited with this role")
+
+	code, body = createCredit(`{"personId": 2, "role": "director"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Contains(t, body, "no person exists with this id")
+
+	credits, err := app.models.Credits.GetAllForMovie(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, credits, 1) {
+		assert.Equal(t, "Ripley", credits[0].Character)
+	}
+
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		r := httptest.NewRequest(http.MethodDelete, "/v1/movies/1/credits/1", nil)
+
+		code, _, _ := app.serveAs(t, user, "/v1/movies/:id/credits/:credit_id", app.deleteMovieCreditHandler, r)
+
+		assert.Equal(t, want, code)
+	}
+}
+
+func TestShowMovieWithCreditsIsNeverNotModified(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"science-fiction"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	showMovie := func(path, etag string) (int, string, string) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("If-None-Match", etag)
+
+		code, header, body := app.serveAs(t, data.AnonymousUser, "/v1/movies/:id", app.showMovieHandler, r)
+		return code, header.Get("ETag"), body
+	}
+
+	_, etag, _ := showMovie("/v1/movies/1?include=credits", "")
+
+	person := &data.Person{Name: "Ridley Scott"}
+
+	err = app.models.People.Insert(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Credits change without changing the movie's version
+	err = app.models.Credits.Insert(&data.Credit{MovieID: movie.ID, PersonID: person.ID, Role: data.CreditRoleDirector})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, body := showMovie("/v1/movies/1?include=credits", etag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Ridley Scott")
+
+	code, _, _ = showMovie("/v1/movies/1", etag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const envDevelopment = "development"
+
+// previewMailHandler renders an email template with its example data, so templates can be
+// checked in a browser while working on them. It's only routed in development.
+func (app *application) previewMailHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("template")
+	locale := app.readString(qs, "locale", mailer.DefaultLocale)
+	format := app.readString(qs, "format", "html")
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(format, "html", "text"), "format", "must be html or text")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	msg, err := app.mailer.Preview(name, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n%s", msg.Subject, msg.PlainBody)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, msg.HTMLBody)
+}
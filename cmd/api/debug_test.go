@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewMail(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.env = envDevelopment
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/debug/mail/preview/user_welcome?locale=fr")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "text/html; charset=utf-8", headers.Get("Content-Type"))
+	assert.Contains(t, body, "<p>Bonjour Alice,</p>")
+
+	code, _, body = ts.get(t, "/debug/mail/preview/user_welcome?format=text")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Subject: Welcome to Greenlight!\n")
+
+	code, _, _ = ts.get(t, "/debug/mail/preview/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _, _ = ts.get(t, "/debug/mail/preview/user_welcome?format=pdf")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestPreviewMailOnlyInDevelopment(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, _ := ts.get(t, "/debug/mail/preview/user_welcome")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+// How many movies are written between flushes, so clients receive the export as it's generated
+const exportFlushInterval = 500
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieQuery
+		data.Filters
+		Format string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.MovieQuery = app.readMovieQuery(qs, v)
+	input.Format = app.readString(qs, "format", exportFormatFromAccept(r.Header.Get("Accept")))
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = movieSortSafeList
+
+	v.Check(
+		validator.PermittedValue(input.Format, exportFormatCSV, exportFormatNDJSON),
+		"format",
+		"must be one of csv or ndjson",
+	)
+	v.Check(validator.PermittedValue(input.Sort, input.SortSafeList...), "sort", "invalid sort value")
+	v.Check(!validator.PermittedValue(data.MovieFieldOnWatchlist, input.Fields...), "fields", "onWatchlist can't be exported")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fields := input.Fields
+	if len(fields) == 0 {
+		fields = data.MovieFieldSafeList
+	}
+
+	var writeMovie func(*data.Movie) error
+	var flush func() error
+
+	switch input.Format {
+	case exportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		csvWriter := csv.NewWriter(w)
+		csvWriter.Write(fields)
+
+		writeMovie = func(movie *data.Movie) error {
+			return csvWriter.Write(movieCSVRecord(movie, fields))
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		encoder := json.NewEncoder(w)
+
+		writeMovie = func(movie *data.Movie) error {
+			return encoder.Encode(movie.SelectFields(fields))
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, input.Format))
+
+	flusher, canFlush := w.(http.Flusher)
+	written := 0
+
+	err := app.models.Movies.Export(r.Context(), input.MovieQuery, input.Filters, func(movie *data.Movie) error {
+		err := writeMovie(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+
+		if written%exportFlushInterval == 0 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && written == 0 {
+		w.Header().Del("Content-Disposition")
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err == nil {
+		err = flush()
+	}
+
+	// Once movies have been written the status code and part of the body may have been sent,
+	// so there's no way to give the client an error response and the export is just cut short
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func exportFormatFromAccept(accept string) string {
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return exportFormatNDJSON
+	default:
+		return exportFormatCSV
+	}
+}
+
+func movieCSVRecord(movie *data.Movie, fields []string) []string {
+	record := make([]string, len(fields))
+
+	for i, field := range fields {
+		switch field {
+		case "id":
+			record[i] = strconv.FormatInt(movie.ID, 10)
+		case "title":
+			record[i] = movie.Title
+		case "year":
+			record[i] = strconv.Itoa(int(movie.Year))
+		case "runtime":
+			record[i] = strconv.Itoa(int(movie.Runtime))
+		case "genres":
+			record[i] = strings.Join(movie.Genres, "|")
+		case "version":
+			record[i] = strconv.Itoa(int(movie.Version))
+		case "rating":
+			record[i] = strconv.FormatFloat(movie.Rating, 'f', 2, 64)
+		case "reviewCount":
+			record[i] = strconv.Itoa(int(movie.ReviewCount))
+		case "poster":
+			if movie.Poster != "" {
+				record[i] = movie.Poster.URL()
+			}
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportMoviesRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/export?format=csv")
+
+	assert.Equal(t, http.StatusUnauthorized, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnauthorized, map[string]string{
+		"error": "you must be authenticated to access this resource",
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"genres": genres}, nil)
+}
+
+// normalizeGenres replaces the movie's genres with their canonical slugs, adding a validation
+// error with suggestions for any that aren't known
+func (app *application) normalizeGenres(movie *data.Movie, v *validator.Validator) {
+	normalizeMovieGenres(app.genres, movie, v)
+}
+
+func normalizeMovieGenres(taxonomy data.GenreTaxonomy, movie *data.Movie, v *validator.Validator) {
+	if movie.Genres == nil {
+		return
+	}
+
+	normalized, unknown := taxonomy.Normalize(movie.Genres)
+	if len(unknown) > 0 {
+		v.AddError("genres", data.UnknownGenresMessage(movie.Genres, unknown))
+		return
+	}
+
+	movie.Genres = normalized
+}
@@ -1,7 +1,72 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	dependencyUp   = "up"
+	dependencyDown = "down"
+)
+
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	app.serveJSON(w, r, http.StatusOK, nil, nil)
 }
+
+// livenessHandler only reports that the process is up and able to serve requests,
+// it purposefully doesn't check any dependencies so we aren't restarted when they fail
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"status": "alive"}, nil)
+}
+
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if app.shuttingDown.Load() {
+		data := map[string]string{"status": "shutting down"}
+		app.serveJSON(w, r, http.StatusServiceUnavailable, data, nil)
+		return
+	}
+
+	dependencies := map[string]dependencyStatus{
+		"database": app.checkDependency(r.Context(), app.pingDB),
+	}
+
+	if app.config.healthcheck.checkSMTP {
+		dependencies["smtp"] = app.checkDependency(r.Context(), app.mailer.Ping)
+	}
+
+	status := http.StatusOK
+	data := map[string]any{"status": "ready", "dependencies": dependencies}
+
+	for _, dependency := range dependencies {
+		if dependency.Status != dependencyUp {
+			status = http.StatusServiceUnavailable
+			data["status"] = "unavailable"
+			break
+		}
+	}
+
+	app.serveJSON(w, r, status, data, nil)
+}
+
+func (app *application) checkDependency(ctx context.Context, ping func(context.Context) error) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, app.config.healthcheck.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ping(ctx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		return dependencyStatus{Status: dependencyDown, LatencyMS: latency, Error: err.Error()}
+	}
+
+	return dependencyStatus{Status: dependencyUp, LatencyMS: latency}
+}
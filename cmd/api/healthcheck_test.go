@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,3 +25,106 @@ func TestHealthcheck(t *testing.T) {
 
 	assert.JSONEq(t, expected_body, body)
 }
+
+func TestHealthcheckLive(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/healthcheck/live")
+
+	assert.Equal(t, http.StatusOK, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusOK, map[string]string{"status": "alive"})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestHealthcheckReadyWhileShuttingDown(t *testing.T) {
+	app := newTestApplication(t)
+	app.shuttingDown.Store(true)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/healthcheck/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	expected_body := createExpectedBodyResponse(
+		t, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"},
+	)
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestHealthcheckReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		ping       func(context.Context) error
+		wantCode   int
+		wantStatus string
+		wantDB     dependencyStatus
+	}{
+		{
+			name:       "database up",
+			ping:       func(ctx context.Context) error { return nil },
+			wantCode:   http.StatusOK,
+			wantStatus: "ready",
+			wantDB:     dependencyStatus{Status: dependencyUp},
+		},
+		{
+			name:       "database down",
+			ping:       func(ctx context.Context) error { return errors.New("connection refused") },
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+			wantDB:     dependencyStatus{Status: dependencyDown, Error: "connection refused"},
+		},
+		{
+			name: "database timing out",
+			ping: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+			wantDB:     dependencyStatus{Status: dependencyDown, Error: "context deadline exceeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.healthcheck.timeout = 50 * time.Millisecond
+			app.pingDB = tt.ping
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, _, body := ts.get(t, "/v1/healthcheck/ready")
+
+			assert.Equal(t, tt.wantCode, code)
+
+			var response struct {
+				Data struct {
+					Status       string                      `json:"status"`
+					Dependencies map[string]dependencyStatus `json:"dependencies"`
+				} `json:"data"`
+			}
+
+			err := json.Unmarshal([]byte(body), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.wantStatus, response.Data.Status)
+
+			database := response.Data.Dependencies["database"]
+
+			assert.GreaterOrEqual(t, database.LatencyMS, 0.0)
+			assert.Contains(t, body, `"latencyMs"`)
+
+			database.LatencyMS = 0
+			assert.Equal(t, tt.wantDB, database)
+		})
+	}
+}
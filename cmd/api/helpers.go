@@ -9,8 +9,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
 )
 
@@ -48,6 +50,12 @@ func (app *application) serveJSON(w http.ResponseWriter, r *http.Request, status
 	}
 
 	for key, value := range headers {
+		// Middleware may already have said what the response varies on, which mustn't be lost
+		if key == "Vary" {
+			w.Header()[key] = append(w.Header()[key], value...)
+			continue
+		}
+
 		w.Header()[key] = value
 	}
 
@@ -65,58 +73,67 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, input a
 
 	err := decoder.Decode(input)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		var maxBytesError *http.MaxBytesError
+		return translateJSONError(err)
+	}
 
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+	err = decoder.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must only contain a single JSON value")
+	}
 
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+	return nil
+}
 
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+// translateJSONError turns errors from decoding JSON into messages that are safe and helpful to return to clients
+func translateJSONError(err error) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	var maxBytesError *http.MaxBytesError
 
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
 
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unkown key %s", fieldName)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly-formed JSON")
 
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
 
-		case errors.As(err, &invalidUnmarshalError):
-			// Signifies a syntax error in development and should be fixed immediately
-			panic(err)
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
 
-		default:
-			return err
-		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Errorf("body contains unkown key %s", fieldName)
 
-	}
+	case errors.As(err, &maxBytesError):
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
 
-	err = decoder.Decode(&struct{}{})
-	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
-	}
+	case errors.As(err, &invalidUnmarshalError):
+		// Signifies a syntax error in development and should be fixed immediately
+		panic(err)
 
-	return nil
+	default:
+		return err
+	}
 }
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads the ID from a route parameter other than :id, such as :review_id
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -158,6 +175,130 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+func (app *application) readRuntime(qs url.Values, key string, v *validator.Validator) data.Runtime {
+	s := qs.Get(key)
+
+	if s == "" {
+		return 0
+	}
+
+	runtime, err := data.ParseRuntime(s)
+	if err != nil {
+		v.AddError(key, `must be a number of minutes, example: "102 mins"`)
+		return 0
+	}
+
+	return runtime
+}
+
+// readTime accepts either a full RFC 3339 timestamp or just a date, which is taken as midnight UTC
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be a date (2006-01-02) or RFC 3339 timestamp")
+	return time.Time{}
+}
+
+// movieETag returns an ETag for the movie based on its version, which changes with every update. The
+// rating and review count are included too, as they change with the movie's reviews, not its version.
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d-%d-%g"`, movie.Version, movie.ReviewCount, movie.Rating)
+}
+
+// localizedMovieETag returns the ETag of a response that may have the movie's title in another
+// language. Each language is a different representation of the same version, so the locale of
+// the translation is included to stop a 304 confirming a cached copy in another language.
+func localizedMovieETag(movie *data.Movie) string {
+	if movie.Locale == "" {
+		return movieETag(movie)
+	}
+
+	return fmt.Sprintf(`"%d-%d-%g;%s"`, movie.Version, movie.ReviewCount, movie.Rating, movie.Locale)
+}
+
+// movieETagMatches reports whether an If-Match header holds the movie's current ETag. Updates apply
+// to the movie in every language, so the ETag of any localized response for the version matches.
+func movieETagMatches(header string, movie *data.Movie) bool {
+	candidates := strings.Split(header, ",")
+
+	for i, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+
+		if j := strings.IndexByte(candidate, ';'); j != -1 && strings.HasSuffix(candidate, `"`) {
+			candidate = candidate[:j] + `"`
+		}
+
+		candidates[i] = candidate
+	}
+
+	return etagMatches(strings.Join(candidates, ","), movieETag(movie), false)
+}
+
+// etagMatches reports whether the etag is in the comma separated list of an If-Match or If-None-Match header.
+// Weak comparison ignores the W/ prefix, and should only be used for If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exponentialBackoff returns how long to wait after the given number of attempts, starting at
+// base and doubling after each attempt, up to max
+func exponentialBackoff(base, max time.Duration, attempts int) time.Duration {
+	backoff := base
+
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
 // background runs a fn in a new go routine and recovers any panics that happen
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{name: "exact match", header: `"3"`, want: true},
+		{name: "match in list", header: `"1", "3"`, want: true},
+		{name: "wildcard", header: "*", want: true},
+		{name: "different version", header: `"2"`, want: false},
+		{name: "weak tag with strong comparison", header: `W/"3"`, want: false},
+		{name: "weak tag with weak comparison", header: `W/"3"`, weak: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.header, `"3"`, tt.weak))
+		})
+	}
+}
+
+func TestMovieETag(t *testing.T) {
+	movie := &data.Movie{ID: 1, Title: "Moana", Version: 3}
+
+	etag := movieETag(movie)
+
+	assert.Equal(t, `"3-0-0"`, etag)
+
+	// Reviews change the rating without changing the version
+	movie.Rating = 7.5
+	movie.ReviewCount = 2
+
+	assert.NotEqual(t, etag, movieETag(movie))
+	assert.Equal(t, `"3-2-7.5"`, movieETag(movie))
+}
+
+func TestLocalizedMovieETag(t *testing.T) {
+	movie := &data.Movie{ID: 1, Title: "Moana", Version: 3, Rating: 7.5, ReviewCount: 2}
+
+	assert.Equal(t, movieETag(movie), localizedMovieETag(movie))
+
+	movie.Title, movie.OriginalTitle, movie.Locale = "Vaiana", "Moana", "fr"
+
+	assert.Equal(t, `"3-2-7.5;fr"`, localizedMovieETag(movie))
+
+	movie.Locale = "pt-BR"
+
+	assert.Equal(t, `"3-2-7.5;pt-BR"`, localizedMovieETag(movie))
+}
+
+func TestMovieETagMatches(t *testing.T) {
+	movie := &data.Movie{ID: 1, Title: "Moana", Version: 3}
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "current version", header: `"3-0-0"`, want: true},
+		{name: "localized current version", header: `"3-0-0;fr"`, want: true},
+		{name: "localized in list", header: `"2-0-0;fr", "3-0-0;pt-BR"`, want: true},
+		{name: "wildcard", header: "*", want: true},
+		{name: "localized old version", header: `"2-0-0;fr"`, want: false},
+		{name: "weak localized tag", header: `W/"3-0-0;fr"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, movieETagMatches(tt.header, movie))
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+func (app *application) movieHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-version"
+	input.Filters.SortSafeList = []string{"-version"}
+
+	if input.Filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, pageInfo, err := app.models.Movies.GetRevisions(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every movie has at least the revision recorded when it was created
+	if pageInfo.TotalRecords == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	data := map[string]any{"revisions": revisions, "pageInfo": pageInfo}
+
+	app.serveJSON(w, r, http.StatusOK, data, nil)
+}
+
+// revertMovieHandler sets a movie's title, year, runtime and genres back to how they were at
+// an earlier version. The revert is saved as a new version, so it can itself be reverted.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be a positive integer")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && !movieETagMatches(match, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Movies.GetRevision(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no revision of this movie exists with that version")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.revertTo(movie, revision, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.movieEditConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	app.serveJSON(w, r, http.StatusOK, movie, headers)
+}
+
+// revertTo sets the movie's title, year, runtime and genres to how they were after the revision,
+// leaving everything else as it is now. The reverted movie is validated again, as validation
+// rules and genres may have changed since the revision was saved.
+func (app *application) revertTo(movie *data.Movie, revision *data.MovieRevision, v *validator.Validator) error {
+	snapshot, err := revision.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	movie.Title = snapshot.Title
+	movie.Year = snapshot.Year
+	movie.Runtime = snapshot.Runtime
+	movie.Genres = snapshot.Genres
+
+	app.normalizeGenres(movie, v)
+	movie.Validate(v)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevertTo(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Revisions are snapshots of the whole row, including columns a revert leaves alone
+	revision := &data.MovieRevision{
+		MovieID: 1,
+		Version: 1,
+		After: json.RawMessage(`{
+			"id": 1, "created_at": "2023-01-02T15:04:05Z", "title": "Black Panther", "year": 2018,
+			"runtime": 134, "genres": ["sci-fi", "action"], "version": 1, "deleted_at": null,
+			"rating": 0, "review_count": 0, "poster": null
+		}`),
+	}
+
+	movie := &data.Movie{ID: 1, Title: "Black Panther II", Year: 2022, Runtime: 161, Genres: []string{"drama"}, Version: 4, Rating: 4.5, ReviewCount: 2}
+	v := validator.New()
+
+	err := app.revertTo(movie, revision, v)
+
+	assert.NoError(t, err)
+	assert.True(t, v.Valid())
+	assert.Equal(t, &data.Movie{
+		ID:          1,
+		Title:       "Black Panther",
+		Year:        2018,
+		Runtime:     134,
+		Genres:      []string{"science-fiction", "action"},
+		Version:     4,
+		Rating:      4.5,
+		ReviewCount: 2,
+	}, movie)
+
+	// A genre that's since been removed makes the revision invalid to revert to
+	revision.After = json.RawMessage(`{"id": 1, "title": "Black Panther", "year": 2018, "runtime": 134, "genres": ["superhero"], "version": 1}`)
+	v = validator.New()
+
+	err = app.revertTo(movie, revision, v)
+
+	assert.NoError(t, err)
+	assert.Contains(t, v.Errors, "genres")
+}
+
+func TestRevertMovie(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movie.Title = "Moana 2"
+	movie.Year = 2024
+
+	err = app.models.Movies.Update(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/1/revert?version=5", nil)
+
+	code, _, body := app.serveAs(t, user, "/v1/movies/:id/revert", app.revertMovieHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.JSONEq(t, createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"version": "no revision of this movie exists with that version"},
+	}), body)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/movies/1/revert?version=1", nil)
+
+	code, header, _ := app.serveAs(t, user, "/v1/movies/:id/revert", app.revertMovieHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, movieETag(&data.Movie{Version: 3}), header.Get("ETag"))
+
+	reverted, err := app.models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Moana", reverted.Title)
+	assert.Equal(t, int32(2016), reverted.Year)
+
+	// The revert is recorded as a change of its own
+	revisions, _, err := app.models.Movies.GetRevisions(movie.ID, data.Filters{Page: 1, PageSize: 20, Sort: "-version", SortSafeList: []string{"-version"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, revisions, 3) {
+		assert.Equal(t, data.RevisionActionUpdate, revisions[0].Action)
+		assert.Equal(t, int32(3), revisions[0].Version)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+// importRow is a movie read from an import file, along with the line it started on
+// and any reasons it was rejected. The movie is nil if the row couldn't be read as one.
+type importRow struct {
+	line   int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+// importMovies implements the import-movies command, which loads movies from CSV and JSON files:
+//
+//	api import-movies [-dry-run] [-upsert] FILE...
+//
+// Genres are normalized against the given taxonomy, the same as movies created through the API.
+func importMovies(models data.Models, genres data.GenreTaxonomy, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-movies", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	dryRun := flags.Bool("dry-run", false, "validate the files without importing anything")
+	upsert := flags.Bool("upsert", false, "update movies with the same title and year instead of inserting duplicates")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return errors.New("import-movies: at least one CSV or JSON file must be provided")
+	}
+
+	var movies []*data.Movie
+	rejected := 0
+	// Upserting twice against the same title and year in one import would be ambiguous
+	seen := make(map[string]string)
+
+	for _, path := range flags.Args() {
+		rows, err := readImportFile(path)
+		if err != nil {
+			return fmt.Errorf("import-movies: %s: %w", path, err)
+		}
+
+		for _, row := range rows {
+			v := validator.New()
+
+			// Errors from parsing the row take priority over the validation errors they cause
+			for key, message := range row.errors {
+				v.AddError(key, message)
+			}
+
+			// Rows that couldn't be read as a movie at all only have their parsing errors reported
+			if row.movie != nil {
+				normalizeMovieGenres(genres, row.movie, v)
+				row.movie.Validate(v)
+			}
+
+			if *upsert && v.Valid() {
+				key := fmt.Sprintf("%s\x00%d", row.movie.Title, row.movie.Year)
+
+				if previous, exists := seen[key]; exists {
+					v.AddError("title", "duplicate of the movie with the same title and year at "+previous)
+				}
+				seen[key] = fmt.Sprintf("%s:%d", path, row.line)
+			}
+
+			row.errors = v.Errors
+
+			if len(row.errors) > 0 {
+				rejected++
+				fmt.Fprintf(out, "rejected %s:%d: %s\n", path, row.line, formatImportErrors(row.errors))
+				continue
+			}
+
+			movies = append(movies, row.movie)
+		}
+	}
+
+	if *dryRun {
+		fmt.Fprintf(out, "dry run: %d movies valid, %d rejected\n", len(movies), rejected)
+		return nil
+	}
+
+	if len(movies) == 0 {
+		fmt.Fprintf(out, "nothing to import, %d rejected\n", rejected)
+		return nil
+	}
+
+	inserted, updated, err := models.Movies.Import(movies, *upsert)
+	if err != nil {
+		return fmt.Errorf("import-movies: %w", err)
+	}
+
+	fmt.Fprintf(out, "imported movies: %d inserted, %d updated, %d rejected\n", inserted, updated, rejected)
+
+	return nil
+}
+
+func readImportFile(path string) ([]*importRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readImportCSV(file)
+	case ".json":
+		return readImportJSON(file)
+	default:
+		return nil, errors.New("unsupported file type, must be .csv or .json")
+	}
+}
+
+// readImportCSV reads movies from CSV with a header row naming the title, year, runtime and genres columns.
+// Genres are separated by "|", the same as in CSV exports.
+func readImportCSV(r io.Reader) ([]*importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("header is missing the %s column", required)
+		}
+	}
+
+	rows := []*importRow{}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := &importRow{line: line, movie: &data.Movie{}}
+		v := validator.New()
+
+		row.movie.Title = record[columns["title"]]
+
+		year, err := strconv.ParseInt(record[columns["year"]], 10, 32)
+		if err != nil {
+			v.AddError("year", "must be an integer value")
+		}
+		row.movie.Year = int32(year)
+
+		runtime, err := data.ParseRuntime(record[columns["runtime"]])
+		if err != nil {
+			v.AddError("runtime", err.Error())
+		}
+		row.movie.Runtime = runtime
+
+		row.movie.Genres = []string{}
+		for _, genre := range strings.Split(record[columns["genres"]], "|") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				row.movie.Genres = append(row.movie.Genres, genre)
+			}
+		}
+
+		if !v.Valid() {
+			row.errors = v.Errors
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readImportJSON reads movies from a JSON array of objects, in the same shape as the body of POST /v1/movies,
+// except that runtimes may also be given as a number of minutes
+func readImportJSON(r io.Reader) ([]*importRow, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('[') {
+		return nil, errors.New("must contain a JSON array of movies")
+	}
+
+	rows := []*importRow{}
+
+	for decoder.More() {
+		// InputOffset points at the end of the previous value, so skip past the separator to the object itself
+		offset := decoder.InputOffset()
+		for offset < int64(len(content)) && bytes.IndexByte([]byte(" \t\r\n,"), content[offset]) != -1 {
+			offset++
+		}
+
+		// Only badly-formed JSON stops the file being read, as there's no way to find where the next
+		// movie starts. Movies that are well-formed but the wrong shape are rejected one at a time.
+		var item json.RawMessage
+
+		err := decoder.Decode(&item)
+		if err != nil {
+			return nil, translateJSONError(err)
+		}
+
+		row := &importRow{line: 1 + bytes.Count(content[:offset], []byte("\n"))}
+
+		var input struct {
+			Title   string          `json:"title"`
+			Year    int32           `json:"year"`
+			Runtime json.RawMessage `json:"runtime"`
+			Genres  []string        `json:"genres"`
+		}
+
+		if !bytes.HasPrefix(item, []byte("{")) {
+			row.errors = map[string]string{"movie": "must be a JSON object"}
+			rows = append(rows, row)
+			continue
+		}
+
+		err = json.Unmarshal(item, &input)
+		if err != nil {
+			// The messages are written for request bodies, here they're about the movie
+			row.errors = map[string]string{"movie": strings.TrimPrefix(translateJSONError(err).Error(), "body ")}
+			rows = append(rows, row)
+			continue
+		}
+
+		row.movie = &data.Movie{
+			Title:  input.Title,
+			Year:   input.Year,
+			Genres: input.Genres,
+		}
+
+		if input.Runtime != nil {
+			var runtime string
+			if json.Unmarshal(input.Runtime, &runtime) != nil {
+				runtime = string(input.Runtime)
+			}
+
+			row.movie.Runtime, err = data.ParseRuntime(runtime)
+			if err != nil {
+				row.errors = map[string]string{"runtime": err.Error()}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func formatImportErrors(fieldErrors map[string]string) string {
+	messages := make([]string, 0, len(fieldErrors))
+
+	for key, message := range fieldErrors {
+		messages = append(messages, fmt.Sprintf("%s %s", key, message))
+	}
+
+	sort.Strings(messages)
+
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportMoviesDryRunReportsRejectedLines(t *testing.T) {
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "movies.csv")
+	csvContent := "title,year,runtime,genres\n" +
+		"Moana,2016,107 mins,animation|adventure\n" +
+		"Black Panther,2018,134,\n" +
+		"Deadpool,twenty,108,action|comedy\n"
+
+	jsonPath := filepath.Join(dir, "movies.json")
+	jsonContent := `[
+  {"title": "The Breakfast Club", "year": 1986, "runtime": "96 mins", "genres": ["drama"]},
+  {"title": "", "year": 1986, "runtime": 96, "genres": ["drama"]},
+  {"title": "Heat", "year": "1995", "runtime": 170, "genres": ["drama"]},
+  "Ronin",
+  {"title": "Jaws", "year": 1975, "runtime": 124, "genres": ["drama"]}
+]`
+
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(jsonContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+
+	genres := data.GenreTaxonomy{
+		"action": "action", "adventure": "adventure", "animation": "animation", "comedy": "comedy", "drama": "drama",
+	}
+
+	err := importMovies(data.Models{}, genres, []string{"-dry-run", csvPath, jsonPath}, out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"rejected "+csvPath+":3: genres must contain at least 1 genre\n"+
+		"rejected "+csvPath+":4: year must be an integer value\n"+
+		"rejected "+jsonPath+":3: title must be provided\n"+
+		"rejected "+jsonPath+":4: movie contains incorrect JSON type for field \"year\"\n"+
+		"rejected "+jsonPath+":5: movie must be a JSON object\n"+
+		"dry run: 3 movies valid, 5 rejected\n",
+		out.String(),
+	)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+)
+
+const (
+	jobSendWelcomeEmail            = "send_welcome_email"
+	jobSendEmailChangeConfirmation = "send_email_change_confirmation"
+	jobSendEmailChangedNotice      = "send_email_changed_notice"
+	jobSendPasswordReset           = "send_password_reset"
+)
+
+const (
+	jobBaseBackoff = 10 * time.Second
+	jobMaxBackoff  = time.Hour
+)
+
+type jobHandler func(ctx context.Context, payload json.RawMessage) error
+
+// jobKind configures how the jobs of a kind are run
+type jobKind struct {
+	handle jobHandler
+	// concurrency is the most jobs of the kind each instance of the API runs at once
+	concurrency int
+	maxAttempts int
+	// timeout cancels the context the job is run with. Claimed jobs are leased for twice as
+	// long, so a job that respects its context never outlives its lease.
+	timeout time.Duration
+}
+
+func (app *application) jobKinds() map[string]jobKind {
+	return map[string]jobKind{
+		jobSendWelcomeEmail: {
+			handle:      typedJob(app.sendWelcomeEmail),
+			concurrency: 2,
+			maxAttempts: 8,
+			timeout:     time.Minute,
+		},
+		jobSendEmailChangeConfirmation: {
+			handle:      typedJob(app.sendEmailChangeConfirmation),
+			concurrency: 1,
+			maxAttempts: 8,
+			timeout:     time.Minute,
+		},
+		jobSendEmailChangedNotice: {
+			handle:      typedJob(app.sendEmailChangedNotice),
+			concurrency: 1,
+			maxAttempts: 8,
+			timeout:     time.Minute,
+		},
+		jobSendPasswordReset: {
+			handle:      typedJob(app.sendPasswordReset),
+			concurrency: 1,
+			maxAttempts: 8,
+			timeout:     time.Minute,
+		},
+	}
+}
+
+// typedJob adapts a handler that takes a typed payload, decoding each job's payload into it
+func typedJob[T any](handle func(ctx context.Context, payload T) error) jobHandler {
+	return func(ctx context.Context, js json.RawMessage) error {
+		var payload T
+
+		decoder := json.NewDecoder(bytes.NewReader(js))
+		decoder.DisallowUnknownFields()
+
+		err := decoder.Decode(&payload)
+		if err != nil {
+			return fmt.Errorf("decoding payload: %w", err)
+		}
+
+		return handle(ctx, payload)
+	}
+}
+
+// enqueueJob queues a job to be run by one of the workers for its kind. The payload must be
+// the type the kind's handler takes.
+func (app *application) enqueueJob(kind string, payload any) error {
+	jk, ok := app.jobKinds()[kind]
+	if !ok {
+		panic("unknown job kind: " + kind)
+	}
+
+	return app.models.Jobs.Enqueue(kind, payload, jk.maxAttempts)
+}
+
+// enqueueJobTx queues the job in the transaction, so it's only run if the transaction commits
+func (app *application) enqueueJobTx(ctx context.Context, tx *sql.Tx, kind string, payload any) error {
+	jk, ok := app.jobKinds()[kind]
+	if !ok {
+		panic("unknown job kind: " + kind)
+	}
+
+	return app.models.Jobs.EnqueueTx(ctx, tx, kind, payload, jk.maxAttempts)
+}
+
+// startJobWorkers starts the workers for each kind of job, which stop taking new jobs once the
+// context is cancelled. Jobs that are already running are left to finish, so waiting on the
+// application's wait group drains them.
+func (app *application) startJobWorkers(ctx context.Context) {
+	for kind, jk := range app.jobKinds() {
+		kind, jk := kind, jk
+
+		for i := 0; i < jk.concurrency; i++ {
+			app.background(func() {
+				app.runJobs(ctx, kind, jk)
+			})
+		}
+	}
+}
+
+func (app *application) runJobs(ctx context.Context, kind string, jk jobKind) {
+	// A claimed job isn't run again until its lease runs out, which leaves plenty of
+	// time for it to time out and its outcome to be recorded
+	lease := 2 * jk.timeout
+
+	ticker := time.NewTicker(app.config.jobs.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				job, err := app.models.Jobs.Claim(kind, lease)
+				if err != nil {
+					if !errors.Is(err, data.ErrRecordNotFound) {
+						app.logger.PrintError(err, nil)
+					}
+					break
+				}
+
+				app.runJob(jk, job)
+			}
+		}
+	}
+}
+
+// runJob runs the job and records the outcome, scheduling a retry with exponential backoff if it
+// failed. Jobs aren't cancelled on shutdown, only by their own timeout.
+func (app *application) runJob(jk jobKind, job *data.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), jk.timeout)
+	defer cancel()
+
+	jobErr := handleJob(ctx, jk.handle, job.Payload)
+
+	if jobErr == nil {
+		err := app.models.Jobs.Complete(job)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+		return
+	}
+
+	retryAt := time.Now().Add(exponentialBackoff(jobBaseBackoff, jobMaxBackoff, int(job.Attempts)))
+
+	err := app.models.Jobs.Fail(job, jobErr, retryAt)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	properties := map[string]string{
+		"job":      strconv.FormatInt(job.ID, 10),
+		"kind":     job.Kind,
+		"attempts": strconv.Itoa(int(job.Attempts)),
+	}
+
+	if job.Status == data.JobStatusDead {
+		app.logger.PrintError(fmt.Errorf("job failed for the last time: %w", jobErr), properties)
+		return
+	}
+
+	properties["error"] = jobErr.Error()
+	app.logger.PrintInfo("job failed, retrying", properties)
+}
+
+// handleJob runs the handler, turning a panic into an error so it's retried like any other failure
+func handleJob(ctx context.Context, handle jobHandler, payload json.RawMessage) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	return handle(ctx, payload)
+}
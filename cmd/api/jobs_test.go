@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedJob(t *testing.T) {
+	var received welcomeEmailJob
+
+	handle := typedJob(func(ctx context.Context, job welcomeEmailJob) error {
+		received = job
+		return nil
+	})
+
+	err := handle(context.Background(), json.RawMessage(`{"userId": 42}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, welcomeEmailJob{UserID: 42}, received)
+
+	err = handle(context.Background(), json.RawMessage(`{"user": 42}`))
+
+	assert.EqualError(t, err, `decoding payload: json: unknown field "user"`)
+}
+
+func TestHandleJobRecoversPanics(t *testing.T) {
+	handle := func(ctx context.Context, payload json.RawMessage) error {
+		panic("something went wrong")
+	}
+
+	err := handleJob(context.Background(), handle, nil)
+
+	assert.EqualError(t, err, "panic: something went wrong")
+}
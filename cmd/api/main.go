@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/jsonlog"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/storage"
 )
 
 const version = "1.0.0"
@@ -19,9 +22,15 @@ type application struct {
 	version string
 	config  *config
 	logger  *jsonlog.Logger
-	models  data.Models
-	mailer  mailer.Mailer
-	wg      sync.WaitGroup
+	// pingDB checks the database can be reached, for the readiness probe
+	pingDB func(context.Context) error
+	models data.Models
+	// genres is loaded once at startup, as genres are only ever added by migrations
+	genres       data.GenreTaxonomy
+	blobs        storage.BlobStore
+	mailer       mailer.Mailer
+	wg           sync.WaitGroup
+	shuttingDown atomic.Bool
 }
 
 func main() {
@@ -38,20 +47,81 @@ func main() {
 	}
 	defer db.Close()
 
-	smtp := config.smtp
+	models := data.NewModels(db, config.cursorSecret)
+
+	if len(os.Args) > 1 {
+		err = runCommand(models, os.Args[1], os.Args[2:])
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+
+	genres, err := models.Genres.Taxonomy()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	blobs, err := storage.NewLocalStore(config.storage.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	transport, err := newMailTransport(config, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	mailer, err := mailer.New(transport, config.smtp.sender)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	app := &application{
 		version: version,
 		config:  config,
 		logger:  logger,
-		models:  data.NewModels(db),
-		mailer:  mailer.New(smtp.host, smtp.port, smtp.username, smtp.password, smtp.sender),
+		pingDB:  db.PingContext,
+		models:  models,
+		genres:  genres,
+		blobs:   blobs,
+		mailer:  mailer,
 	}
 
 	err = app.serve()
 	logger.PrintFatal(err, nil)
 }
 
+// runCommand runs one of the maintenance commands that can be given instead of starting the server
+func runCommand(models data.Models, command string, args []string) error {
+	switch command {
+	case "import-movies":
+		genres, err := models.Genres.Taxonomy()
+		if err != nil {
+			return err
+		}
+
+		return importMovies(models, genres, args, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// newMailTransport returns the configured transport for delivering emails
+func newMailTransport(config *config, logger *jsonlog.Logger) (mailer.Transport, error) {
+	switch config.mail.transport {
+	case mailTransportDir:
+		return mailer.NewDirTransport(config.mail.dir)
+	case mailTransportLog:
+		return mailer.NewLogTransport(logger), nil
+	case mailTransportMemory:
+		return mailer.NewMemoryTransport(), nil
+	default:
+		smtp := config.smtp
+		return mailer.NewSMTPTransport(smtp.host, smtp.port, smtp.username, smtp.password), nil
+	}
+}
+
 func openDB(config *config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", config.db.dsn)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
@@ -32,12 +33,14 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	v := validator.New()
 
+	app.normalizeGenres(movie, v)
+
 	if movie.Validate(v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -45,6 +48,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	app.serveJSON(w, r, http.StatusCreated, movie, headers)
 }
@@ -56,7 +60,23 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+
+	fields := app.readCSV(r.URL.Query(), "fields", []string{})
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+
+	data.ValidateMovieFields(v, fields)
+
+	for _, related := range include {
+		v.Check(validator.PermittedValue(related, "credits"), "include", fmt.Sprintf("unknown relation %q", related))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetWithFields(id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -67,7 +87,52 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	app.serveJSON(w, r, http.StatusOK, movie, nil)
+	// The title is localized first, as the ETag depends on which language it's in
+	err = app.localizeMovies(r, fields, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag := localizedMovieETag(movie)
+
+	// The ETag only covers the movie itself. Whether it's on the user's watchlist and its credits can
+	// change without it, so responses including either are always sent in full.
+	cacheable := !app.showsOnWatchlist(r, fields) && len(include) == 0
+
+	if match := r.Header.Get("If-None-Match"); match != "" && cacheable && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Accept-Language")
+		if movie.Locale != "" {
+			w.Header().Set("Content-Language", movie.Locale)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.setOnWatchlist(r, fields, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if validator.PermittedValue("credits", include...) {
+		movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	headers := localizedHeaders(movie)
+	headers.Set("ETag", etag)
+
+	if len(fields) > 0 {
+		app.serveJSON(w, r, http.StatusOK, movie.SelectFields(fields), headers)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, movie, headers)
 }
 
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,6 +153,13 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Clients can send back the ETag they fetched the movie with, to make sure they
+	// aren't overwriting changes made since then
+	if match := r.Header.Get("If-Match"); match != "" && !movieETagMatches(match, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	// Using pointers ensures that the zero value for these fields is nil
 	// we can then differenciate between empty values passed and the field not being provided
 	var input struct {
@@ -115,29 +187,33 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Runtime = *input.Runtime
 	}
 
+	v := validator.New()
+
 	if input.Genres != nil {
 		movie.Genres = input.Genres
+		app.normalizeGenres(movie, v)
 	}
 
-	v := validator.New()
-
 	if movie.Validate(v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+			app.movieEditConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	app.serveJSON(w, r, http.StatusOK, movie, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	app.serveJSON(w, r, http.StatusOK, movie, headers)
 }
 
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -147,7 +223,12 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	if match := r.Header.Get("If-Match"); match != "" {
+		app.deleteMovieIfMatch(w, r, id, match)
+		return
+	}
+
+	err = app.models.Movies.Delete(id, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -161,10 +242,41 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "movie successfully deleted"}, nil)
 }
 
+// deleteMovieIfMatch only deletes the movie if it's unchanged since the client fetched the ETag in the If-Match header
+func (app *application) deleteMovieIfMatch(w http.ResponseWriter, r *http.Request, id int64, match string) {
+	movie, err := app.models.Movies.GetWithFields(id, []string{"version"})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !movieETagMatches(match, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err = app.models.Movies.DeleteVersion(id, movie.Version, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "movie successfully deleted"}, nil)
+}
+
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieQuery
 		data.Filters
 	}
 
@@ -172,21 +284,123 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MovieQuery = app.readMovieQuery(qs, v)
+
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafeList = []string{
-		"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime",
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.SortSafeList = movieSortSafeList
+
+	// Results of a fuzzy search are ordered by similarity, which a cursor can't page through
+	v.Check(!input.Fuzzy || input.Cursor == "", "cursor", "must not be combined with a fuzzy search")
+
+	if input.Filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, pageInfo, err := app.models.Movies.GetAll(input.MovieQuery, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "invalid or expired cursor")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.setOnWatchlist(r, input.Fields, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.localizeMovies(r, input.Fields, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := map[string]any{"movies": selectMovieFields(movies, input.Fields), "pageInfo": pageInfo}
+
+	app.serveJSON(w, r, http.StatusOK, data, localizedHeaders())
+}
+
+var movieSortSafeList = []string{
+	"id", "title", "year", "runtime", "rating", "-id", "-title", "-year", "-runtime", "-rating",
+}
+
+// readMovieQuery reads and validates the query string parameters used to filter the list of movies
+func (app *application) readMovieQuery(qs url.Values, v *validator.Validator) data.MovieQuery {
+	movieQuery := data.MovieQuery{
+		Title:               app.readString(qs, "title", ""),
+		Genres:              app.readCSV(qs, "genres", []string{}),
+		GenresMode:          app.readString(qs, "genres_mode", data.GenresModeAll),
+		YearMin:             int32(app.readInt(qs, "year_min", 0, v)),
+		YearMax:             int32(app.readInt(qs, "year_max", 0, v)),
+		RuntimeMin:          app.readRuntime(qs, "runtime_min", v),
+		RuntimeMax:          app.readRuntime(qs, "runtime_max", v),
+		CreatedAfter:        app.readTime(qs, "created_after", v),
+		CreatedBefore:       app.readTime(qs, "created_before", v),
+		PersonID:            int64(app.readInt(qs, "person_id", 0, v)),
+		Fuzzy:               app.readBool(qs, "fuzzy", false, v),
+		SimilarityThreshold: app.config.search.similarityThreshold,
+		Fields:              app.readCSV(qs, "fields", []string{}),
+	}
+
+	// Movies are stored with canonical genres, so the filter has to be normalized the same way to match them
+	if len(movieQuery.Genres) > 0 {
+		normalized, unknown := app.genres.Normalize(movieQuery.Genres)
+		if len(unknown) > 0 {
+			v.AddError("genres", data.UnknownGenresMessage(movieQuery.Genres, unknown))
+		}
+
+		movieQuery.Genres = normalized
+	}
+
+	movieQuery.Validate(v)
+	data.ValidateMovieFields(v, movieQuery.Fields)
+
+	return movieQuery
+}
+
+// selectMovieFields narrows the movies down to a sparse fieldset, if one was requested
+func selectMovieFields(movies []*data.Movie, fields []string) any {
+	if len(fields) == 0 {
+		return movies
+	}
+
+	selected := make([]map[string]any, len(movies))
+	for i, movie := range movies {
+		selected[i] = movie.SelectFields(fields)
+	}
+
+	return selected
+}
+
+func (app *application) listDeletedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
 	}
 
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortSafeList = []string{"-deleted_at"}
+
 	if input.Filters.Validate(v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, pageInfo, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, pageInfo, err := app.models.Movies.GetAllDeleted(input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -196,3 +410,27 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	app.serveJSON(w, r, http.StatusOK, data, nil)
 }
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	app.serveJSON(w, r, http.StatusOK, movie, headers)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListMoviesRejectsCursorWithPage(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies?page=2&cursor=abc.def")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"cursor": "must not be combined with page"},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestListMoviesValidatesRangeFilters(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies?year_min=2000&year_max=1990&runtime_max=long&genres_mode=some")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{
+			"year_min":    "must not be greater than year_max",
+			"runtime_max": `must be a number of minutes, example: "102 mins"`,
+			"genres_mode": "must be one of all, any or none",
+		},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestSearchMoviesRequiresQuery(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/search?language=klingon")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{
+			"q":        "must be provided",
+			"language": "unsupported language",
+		},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestListMoviesFuzzyRequiresTitle(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies?fuzzy=true")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"title": "must be provided for a fuzzy search"},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestListMoviesFuzzyHasNoCursors(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	for _, title := range []string{"Moana", "Moanna", "Moana 2"} {
+		movie := &data.Movie{Title: title, Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+		err := app.models.Movies.Insert(movie, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies?title=moana&fuzzy=true&page_size=1")
+
+	assert.Equal(t, http.StatusOK, code)
+
+	var response struct {
+		Movies   []map[string]any `json:"movies"`
+		PageInfo data.PageInfo    `json:"pageInfo"`
+	}
+
+	err := json.Unmarshal([]byte(body), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, response.Movies, 1)
+	assert.Empty(t, response.PageInfo.NextCursor)
+	assert.Empty(t, response.PageInfo.PrevCursor)
+}
+
+func TestMovieEditConflictResponse(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		ifMatch  string
+		wantCode int
+	}{
+		{"Conditional request", `"1-0-0"`, http.StatusPreconditionFailed},
+		{"Unconditional request", "", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := httptest.NewRecorder()
+
+			app.movieEditConflictResponse(rr, r)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestShowMovieRejectsUnknownFields(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/1?fields=id,plot")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"fields": `unknown field "plot"`},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestShowMovieRejectsUnknownInclude(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/1?include=credits,awards")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"include": `unknown relation "awards"`},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestCreateMovieSuggestsKnownGenres(t *testing.T) {
+	app := newTestApplication(t)
+
+	body := `{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": ["Sci-Fi", "dramma"]}`
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(body))
+
+	code, _, respBody := app.serveAs(t, testUser, "/v1/movies", app.createMovieHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"genres": `"dramma" is not a known genre, did you mean "drama"?`},
+	})
+
+	assert.JSONEq(t, expected_body, respBody)
+}
+
+func TestListMoviesNormalizesGenres(t *testing.T) {
+	app := newTestApplication(t)
+
+	v := validator.New()
+	movieQuery := app.readMovieQuery(url.Values{"genres": {"Sci-Fi,drama,science-fiction"}}, v)
+
+	assert.True(t, v.Valid())
+	assert.Equal(t, []string{"science-fiction", "drama"}, movieQuery.Genres)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies?genres=dramma")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"genres": `"dramma" is not a known genre, did you mean "drama"?`},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestMovieWriteRoutesRequireAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/v1/movies"},
+		{http.MethodPost, "/v1/movies/bulk"},
+		{http.MethodGet, "/v1/movies/trash"},
+		{http.MethodPatch, "/v1/movies/1"},
+		{http.MethodDelete, "/v1/movies/1"},
+		{http.MethodPost, "/v1/movies/1/restore"},
+		{http.MethodPost, "/v1/movies/1/revert"},
+		{http.MethodPut, "/v1/movies/1/poster"},
+		{http.MethodPost, "/v1/movies/1/credits"},
+		{http.MethodDelete, "/v1/movies/1/credits/1"},
+		{http.MethodPut, "/v1/movies/1/translations/fr"},
+		{http.MethodDelete, "/v1/movies/1/translations/fr"},
+		{http.MethodPost, "/v1/people"},
+		{http.MethodPatch, "/v1/people/1"},
+		{http.MethodDelete, "/v1/people/1"},
+	}
+
+	for _, route := range routes {
+		req, err := http.NewRequest(route.method, ts.URL+route.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, rs.StatusCode, "%s %s", route.method, route.path)
+	}
+
+	code, _, _ := ts.get(t, "/v1/movies/1/history?page=0")
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "reads stay public")
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/storage"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	maxPosterBytes = 5 * 1_048_576
+	// Posters are decoded in full to generate thumbnails, so their dimensions are
+	// limited to keep the memory needed for each upload bounded
+	minPosterDimension = 200
+	maxPosterDimension = 4000
+	// A 16-bit PNG takes 8 bytes a pixel once decoded, so the area is limited as well
+	maxPosterPixels      = 12_000_000
+	posterThumbnailWidth = 200
+)
+
+// Poster names are generated by uploadPosterHandler, anything else can't be a poster
+var posterNameRX = regexp.MustCompile(`^[0-9]+-[0-9a-f]{16}(-thumb)?\.(jpg|png)$`)
+
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && !movieETagMatches(match, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	content, err := app.readPosterUpload(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	img, ext := validatePoster(v, content)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Names include a hash of the content, so a poster's URL changes whenever it does
+	// and it can be cached indefinitely
+	sum := sha256.Sum256(content)
+	name := data.Poster(fmt.Sprintf("%d-%x%s", movie.ID, sum[:8], ext))
+
+	var thumbnailContent bytes.Buffer
+
+	err = jpeg.Encode(&thumbnailContent, resizeImage(img, posterThumbnailWidth), &jpeg.Options{Quality: 85})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.blobs.Put(r.Context(), name.Key(), bytes.NewReader(content))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	previous := movie.Poster
+
+	err = app.blobs.Put(r.Context(), name.ThumbnailKey(), &thumbnailContent)
+	if err != nil {
+		// Re-uploading the current poster stores it under the same name, which must be kept
+		if name != previous {
+			app.deletePosterBlobs(r, name)
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Movies.SetPoster(movie, name, app.contextGetUser(r).ID)
+	if err != nil {
+		if name != previous {
+			app.deletePosterBlobs(r, name)
+		}
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.movieEditConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if previous != "" && previous != name {
+		app.deletePosterBlobs(r, previous)
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	app.serveJSON(w, r, http.StatusOK, movie, headers)
+}
+
+// readPosterUpload reads the poster either from the "poster" field of a multipart form,
+// or from the raw request body
+func (app *application) readPosterUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// Leave room for the multipart boundaries and headers around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxPosterBytes+64*1024)
+
+	var file io.Reader = r.Body
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("multipart body must contain a poster field")
+			}
+			if err != nil {
+				return nil, translatePosterError(err)
+			}
+
+			if part.FormName() == "poster" {
+				file = part
+				break
+			}
+		}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, maxPosterBytes+1))
+	if err != nil {
+		return nil, translatePosterError(err)
+	}
+
+	if len(content) > maxPosterBytes {
+		return nil, fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+	}
+
+	return content, nil
+}
+
+func translatePosterError(err error) error {
+	var maxBytesError *http.MaxBytesError
+
+	if errors.As(err, &maxBytesError) {
+		return fmt.Errorf("poster must not be larger than %d bytes", maxPosterBytes)
+	}
+
+	return err
+}
+
+// validatePoster checks the content is a JPEG or PNG image of an acceptable size, going by
+// its content rather than the type the client claimed it was. The decoded image is returned
+// along with the file extension to store it with.
+func validatePoster(v *validator.Validator, content []byte) (image.Image, string) {
+	v.Check(len(content) > 0, "poster", "must be provided")
+	if !v.Valid() {
+		return nil, ""
+	}
+
+	var ext string
+
+	switch http.DetectContentType(content) {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	default:
+		v.AddError("poster", "must be a JPEG or PNG image")
+		return nil, ""
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("poster", "could not be read as an image")
+		return nil, ""
+	}
+
+	v.Check(
+		config.Width >= minPosterDimension && config.Height >= minPosterDimension,
+		"poster",
+		fmt.Sprintf("must be at least %dx%d pixels", minPosterDimension, minPosterDimension),
+	)
+	v.Check(
+		config.Width <= maxPosterDimension && config.Height <= maxPosterDimension,
+		"poster",
+		fmt.Sprintf("must not be larger than %dx%d pixels", maxPosterDimension, maxPosterDimension),
+	)
+	v.Check(
+		config.Width*config.Height <= maxPosterPixels,
+		"poster",
+		fmt.Sprintf("must not have more than %d pixels", maxPosterPixels),
+	)
+	if !v.Valid() {
+		return nil, ""
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		v.AddError("poster", "could not be read as an image")
+		return nil, ""
+	}
+
+	return img, ext
+}
+
+// resizeImage scales the image down to the given width, keeping its aspect ratio. Each pixel
+// of the result is the average of the pixels it covers in the original.
+func resizeImage(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// deletePosterBlobs removes a poster that's no longer used. Failing to is only logged, as
+// the most it leaves behind is an unreferenced file.
+func (app *application) deletePosterBlobs(r *http.Request, poster data.Poster) {
+	for _, key := range []string{poster.Key(), poster.ThumbnailKey()} {
+		err := app.blobs.Delete(r.Context(), key)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+func (app *application) showPosterHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	if !posterNameRX.MatchString(name) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	etag := strconv.Quote(name)
+
+	// The content of a poster never changes, so there's no need to even open it
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, size, err := app.blobs.Get(r.Context(), data.PosterKey(name))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	contentType := "image/jpeg"
+	if strings.HasSuffix(name, ".png") {
+		contentType = "image/png"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+
+	_, err = io.Copy(w, content)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/storage"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowPoster(t *testing.T) {
+	app := newTestApplication(t)
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+
+	err = blobs.Put(context.Background(), "posters/1-0123456789abcdef.jpg", strings.NewReader("poster"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/v1/posters/1-0123456789abcdef.jpg")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "poster", body)
+	assert.Equal(t, "image/jpeg", header.Get("Content-Type"))
+	assert.Equal(t, "public, max-age=31536000, immutable", header.Get("Cache-Control"))
+
+	code, _, _ = ts.get(t, "/v1/posters/2-0123456789abcdef.jpg")
+
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _, _ = ts.get(t, "/v1/posters/..%2Fsecret.jpg")
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// testPoster returns a PNG of the given size
+func testPoster(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// hookedBlobStore calls beforePut ahead of every Put to the blob store it wraps
+type hookedBlobStore struct {
+	storage.BlobStore
+	beforePut func(key string) error
+}
+
+func (s *hookedBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := s.beforePut(key); err != nil {
+		return err
+	}
+
+	return s.BlobStore.Put(ctx, key, r)
+}
+
+func TestUploadPosterConflictAfterIfMatch(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag := movieETag(movie)
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else edits the movie while the poster is being stored, after If-Match was checked
+	edited := false
+	app.blobs = &hookedBlobStore{BlobStore: blobs, beforePut: func(string) error {
+		if edited {
+			return nil
+		}
+		edited = true
+
+		edit := *movie
+		edit.Title = "Moana (2016)"
+		return app.models.Movies.Update(&edit, user.ID)
+	}}
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/movies/1/poster", bytes.NewReader(testPoster(t, 400, 600)))
+	r.Header.Set("If-Match", etag)
+
+	code, _, _ := app.serveAs(t, user, "/v1/movies/:id/poster", app.uploadPosterHandler, r)
+
+	assert.Equal(t, http.StatusPreconditionFailed, code)
+}
+
+// multipartPoster returns a multipart body with the content in the named field, and its content type
+func multipartPoster(t *testing.T, field string, content []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+
+	fw, err := mw.CreateFormFile(field, "poster.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fw.Write(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &body, mw.FormDataContentType()
+}
+
+func TestReadPosterUpload(t *testing.T) {
+	app := newTestApplication(t)
+
+	poster := testPoster(t, 200, 300)
+	tooLarge := bytes.Repeat([]byte("a"), maxPosterBytes+1)
+
+	multipartBody, multipartType := multipartPoster(t, "poster", poster)
+	wrongFieldBody, wrongFieldType := multipartPoster(t, "image", poster)
+	tooLargePartBody, tooLargePartType := multipartPoster(t, "poster", tooLarge)
+
+	tests := []struct {
+		name        string
+		body        io.Reader
+		contentType string
+		want        []byte
+		wantErr     string
+	}{
+		{"Raw body", bytes.NewReader(poster), "image/png", poster, ""},
+		{"Raw body without a content type", bytes.NewReader(poster), "", poster, ""},
+		{"Multipart", multipartBody, multipartType, poster, ""},
+		{"Multipart without a poster field", wrongFieldBody, wrongFieldType, nil, "multipart body must contain a poster field"},
+		{"Raw body too large", bytes.NewReader(tooLarge), "image/png", nil, "poster must not be larger than 5242880 bytes"},
+		{"Multipart too large", tooLargePartBody, tooLargePartType, nil, "poster must not be larger than 5242880 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/v1/movies/1/poster", tt.body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			content, err := app.readPosterUpload(httptest.NewRecorder(), r)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, content)
+		})
+	}
+}
+
+func TestValidatePoster(t *testing.T) {
+	var jpegPoster bytes.Buffer
+
+	err := jpeg.Encode(&jpegPoster, image.NewGray(image.Rect(0, 0, 300, 450)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := testPoster(t, 300, 450)
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantExt string
+		wantErr string
+	}{
+		{"PNG", png, ".png", ""},
+		{"JPEG", jpegPoster.Bytes(), ".jpg", ""},
+		{"Smallest allowed", testPoster(t, minPosterDimension, minPosterDimension), ".png", ""},
+		{"Largest allowed", testPoster(t, maxPosterDimension, maxPosterPixels/maxPosterDimension), ".png", ""},
+		{"Empty", nil, "", "must be provided"},
+		{"Not an image", []byte("definitely not a poster"), "", "must be a JPEG or PNG image"},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00"), "", "must be a JPEG or PNG image"},
+		{"Truncated PNG", png[:20], "", "could not be read as an image"},
+		{"Corrupt PNG data", append(append([]byte{}, png[:len(png)-20]...), make([]byte, 20)...), "", "could not be read as an image"},
+		{"Too narrow", testPoster(t, minPosterDimension-1, 300), "", "must be at least 200x200 pixels"},
+		{"Too short", testPoster(t, 300, minPosterDimension-1), "", "must be at least 200x200 pixels"},
+		{"Too wide", testPoster(t, maxPosterDimension+1, 300), "", "must not be larger than 4000x4000 pixels"},
+		{"Too many pixels", testPoster(t, maxPosterDimension, maxPosterPixels/maxPosterDimension+1), "", "must not have more than 12000000 pixels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			img, ext := validatePoster(v, tt.content)
+			if tt.wantErr != "" {
+				assert.Equal(t, map[string]string{"poster": tt.wantErr}, v.Errors)
+				assert.Nil(t, img)
+				return
+			}
+
+			assert.True(t, v.Valid(), v.Errors)
+			assert.Equal(t, tt.wantExt, ext)
+			assert.NotNil(t, img)
+		})
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		resizeTo              int
+		wantWidth, wantHeight int
+	}{
+		{"Scales down keeping the aspect ratio", 400, 600, 200, 200, 300},
+		{"Never scales up", 150, 300, 200, 150, 300},
+		{"Keeps at least one row", 4000, 10, 200, 200, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := resizeImage(image.NewGray(image.Rect(0, 0, tt.width, tt.height)), tt.resizeTo)
+
+			assert.Equal(t, image.Rect(0, 0, tt.wantWidth, tt.wantHeight), img.Bounds())
+		})
+	}
+
+	// Each pixel of the result is the average of the pixels it covers
+	src := image.NewGray(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x++ {
+		for y := 10; y < 12; y++ {
+			if x%2 == 0 {
+				src.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+
+	img := resizeImage(src, 2)
+
+	require.Equal(t, image.Rect(0, 0, 2, 1), img.Bounds())
+	for x := 0; x < 2; x++ {
+		r, g, b, a := img.At(x, 0).RGBA()
+		assert.Equal(t, []uint32{0x7fff, 0x7fff, 0x7fff, 0xffff}, []uint32{r, g, b, a})
+	}
+}
+
+func TestUploadPoster(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+
+	poster := testPoster(t, 400, 600)
+	body, contentType := multipartPoster(t, "poster", poster)
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/movies/1/poster", body)
+	r.Header.Set("Content-Type", contentType)
+
+	code, _, _ := app.serveAs(t, user, "/v1/movies/:id/poster", app.uploadPosterHandler, r)
+
+	require.Equal(t, http.StatusOK, code)
+
+	updated, err := app.models.Movies.Get(movie.ID)
+	require.NoError(t, err)
+	assert.Regexp(t, `^1-[0-9a-f]{16}\.png$`, string(updated.Poster))
+
+	stored, _, err := blobs.Get(context.Background(), updated.Poster.Key())
+	require.NoError(t, err)
+	defer stored.Close()
+
+	content, err := io.ReadAll(stored)
+	require.NoError(t, err)
+	assert.Equal(t, poster, content)
+
+	thumbnail, _, err := blobs.Get(context.Background(), updated.Poster.ThumbnailKey())
+	require.NoError(t, err)
+	defer thumbnail.Close()
+
+	config, format, err := image.DecodeConfig(thumbnail)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Config{ColorModel: config.ColorModel, Width: posterThumbnailWidth, Height: 300}, config)
+}
+
+func TestUploadPosterRemovesBlobsWhenThumbnailFails(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	blobs, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.blobs = &hookedBlobStore{BlobStore: blobs, beforePut: func(key string) error {
+		if strings.HasSuffix(key, "-thumb.jpg") {
+			return errors.New("storage unavailable")
+		}
+		return nil
+	}}
+
+	r := httptest.NewRequest(http.MethodPut, "/v1/movies/1/poster", bytes.NewReader(testPoster(t, 400, 600)))
+
+	code, _, _ := app.serveAs(t, user, "/v1/movies/:id/poster", app.uploadPosterHandler, r)
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "posters"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMovieReviewRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.post(t, "/v1/movies/1/reviews", "application/json", strings.NewReader(`{"rating": 8, "body": "Great"}`))
+
+	assert.Equal(t, http.StatusUnauthorized, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnauthorized, map[string]any{
+		"error": "you must be authenticated to access this resource",
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestListMovieReviewsValidatesSort(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/1/reviews?sort=body")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{"sort": "invalid sort value"},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestShowMovieETagChangesWithReviews(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "reviewer@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	showMovie := func(etag string) (int, string) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+		r.Header.Set("If-None-Match", etag)
+
+		code, header, _ := app.serveAs(t, data.AnonymousUser, "/v1/movies/:id", app.showMovieHandler, r)
+		return code, header.Get("ETag")
+	}
+
+	code, etag := showMovie("")
+
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = showMovie(etag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+
+	// The review changes the movie's rating but not its version
+	err = app.models.Reviews.Insert(&data.Review{MovieID: movie.ID, UserID: user.ID, Rating: 8, Body: "Great"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, newETag := showMovie(etag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, etag, newETag)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
 )
 
 func (app *application) routes() http.Handler {
@@ -13,17 +14,110 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activate", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.resetPasswordHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireAuthenticatedUser(app.changePasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireActivatedUser(app.requestEmailChangeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requireActivatedUser(app.listMovieListHandler(data.ListWatchlist)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist/:movie_id", app.requireActivatedUser(app.showMovieListEntryHandler(data.ListWatchlist)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watchlist/:movie_id", app.requireActivatedUser(app.addMovieListEntryHandler(data.ListWatchlist)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:movie_id", app.requireActivatedUser(app.removeMovieListEntryHandler(data.ListWatchlist)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watched", app.requireActivatedUser(app.listMovieListHandler(data.ListWatched)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watched/:movie_id", app.requireActivatedUser(app.showMovieListEntryHandler(data.ListWatched)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watched/:movie_id", app.requireActivatedUser(app.addMovieListEntryHandler(data.ListWatched)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watched/:movie_id", app.requireActivatedUser(app.removeMovieListEntryHandler(data.ListWatched)))
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(data.PermissionMoviesWrite, app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.withFixedRoutes("id", app.methodNotAllowedResponse, fixedRoutes{
+		"bulk": app.requirePermission(data.PermissionMoviesWrite, app.createMoviesBulkHandler),
+	}))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.withFixedRoutes("id", app.showMovieHandler, fixedRoutes{
+		"search":  app.searchMoviesHandler,
+		"suggest": app.suggestMoviesHandler,
+		"export":  app.requirePermission(data.PermissionMoviesExport, app.exportMoviesHandler),
+		"trash":   app.requirePermission(data.PermissionMoviesWrite, app.listDeletedMoviesHandler),
+	}))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(data.PermissionMoviesWrite, app.updateMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission(data.PermissionMoviesWrite, app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission(data.PermissionMoviesWrite, app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/history", app.movieHistoryHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.requirePermission(data.PermissionMoviesWrite, app.revertMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission(data.PermissionMoviesWrite, app.uploadPosterHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/posters/:name", app.showPosterHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.listMovieReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireActivatedUser(app.createMovieReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.showMovieReviewHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.updateMovieReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.deleteMovieReviewHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.listMovieCreditsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission(data.PermissionMoviesWrite, app.createMovieCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requirePermission(data.PermissionMoviesWrite, app.deleteMovieCreditHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.listMovieTranslationsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:locale", app.requirePermission(data.PermissionMoviesWrite, app.putMovieTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:locale", app.requirePermission(data.PermissionMoviesWrite, app.deleteMovieTranslationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requirePermission(data.PermissionWebhooksManage, app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requirePermission(data.PermissionWebhooksManage, app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requirePermission(data.PermissionWebhooksManage, app.showWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requirePermission(data.PermissionWebhooksManage, app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.requirePermission(data.PermissionWebhooksManage, app.listWebhookDeliveriesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission(data.PermissionUsersManage, app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission(data.PermissionUsersManage, app.showUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/activate", app.requirePermission(data.PermissionUsersManage, app.setUserActivatedHandler(true)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/deactivate", app.requirePermission(data.PermissionUsersManage, app.setUserActivatedHandler(false)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission(data.PermissionUsersManage, app.resetUserPasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/revoke-tokens", app.requirePermission(data.PermissionUsersManage, app.revokeUserTokensHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/permissions", app.requirePermission(data.PermissionUsersManage, app.updateUserPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit", app.requirePermission(data.PermissionUsersManage, app.listAuditLogHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.listGenresHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.listPeopleHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission(data.PermissionMoviesWrite, app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.showPersonHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission(data.PermissionMoviesWrite, app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission(data.PermissionMoviesWrite, app.deletePersonHandler))
+
+	if app.config.env == envDevelopment {
+		router.HandlerFunc(http.MethodGet, "/debug/mail/preview/:template", app.previewMailHandler)
+	}
+
+	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+}
+
+type fixedRoutes map[string]http.HandlerFunc
+
+// httprouter doesn't allow a fixed path segment in the same position as a named parameter,
+// so routes such as /v1/movies/search are dispatched by the handler registered for /v1/movies/:id
+func (app *application) withFixedRoutes(param string, next http.HandlerFunc, routes fixedRoutes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := routes[params.ByName(param)]; ok {
+			handler(w, r)
+			return
+		}
 
-	return app.recoverPanic(app.rateLimit(router))
+		next(w, r)
+	}
 }
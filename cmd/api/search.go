@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+func (app *application) searchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieSearch
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+	input.Language = app.readString(qs, "language", "english")
+	input.Mode = app.readString(qs, "mode", data.SearchModeWebsearch)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-rank")
+	input.Filters.SortSafeList = []string{
+		"rank", "id", "title", "year", "runtime", "rating", "-rank", "-id", "-title", "-year", "-runtime", "-rating",
+	}
+
+	input.MovieSearch.Validate(v)
+
+	if input.Filters.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, pageInfo, err := app.models.Movies.Search(input.MovieSearch, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies := make([]*data.Movie, len(results))
+	for i, result := range results {
+		movies[i] = result.Movie
+	}
+
+	err = app.setOnWatchlist(r, nil, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := map[string]any{"movies": results, "pageInfo": pageInfo}
+
+	app.serveJSON(w, r, http.StatusOK, data, nil)
+}
+
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	text := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(text != "", "q", "must be provided")
+	v.Check(len(text) <= 500, "q", "must not be more than 500 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.Suggest(text, limit, app.config.search.similarityThreshold)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"suggestions": suggestions}, nil)
+}
@@ -22,6 +22,30 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Cancelled on shutdown to stop the long running background tasks
+	ctx, stopBackgroundTasks := context.WithCancel(context.Background())
+	defer stopBackgroundTasks()
+
+	app.background(func() {
+		app.purgeTrash(ctx)
+	})
+
+	app.startJobWorkers(ctx)
+
+	app.background(func() {
+		app.dispatchWebhookEvents(ctx)
+	})
+
+	app.background(func() {
+		app.cleanUpWebhookEvents(ctx)
+	})
+
+	for i := 0; i < app.config.webhooks.workers; i++ {
+		app.background(func() {
+			app.deliverWebhooks(ctx)
+		})
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -33,6 +57,10 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
+		// Fail readiness checks straight away so load balancers stop routing new traffic to us
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.healthcheck.drainDelay)
+
 		// Give in-flight requests a 'grace period' of 20 seconds to complete before shutting down
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
@@ -46,6 +74,8 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		stopBackgroundTasks()
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -2,26 +2,181 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/jsonlog"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
 )
 
 func newTestApplication(t *testing.T) *application {
 	testConfig := config{
-		port: 9999,
-		env:  "testing",
+		port:    9999,
+		env:     "testing",
+		limiter: &limiter{enabled: false},
+		healthcheck: &healthcheck{
+			timeout: time.Second,
+		},
+		search: &search{
+			similarityThreshold: 0.3,
+		},
+	}
+
+	mailer, err := mailer.New(mailer.NewMemoryTransport(), "Greenlight <no-reply@test.com>")
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	return &application{
 		version: version,
 		logger:  jsonlog.New(io.Discard, jsonlog.LevelFatal),
 		config:  &testConfig,
+		mailer:  mailer,
+		genres: data.GenreTaxonomy{
+			"action":          "action",
+			"drama":           "drama",
+			"science-fiction": "science-fiction",
+			"sci-fi":          "science-fiction",
+		},
+	}
+}
+
+// newTestDB connects to the database in TEST_DB_DSN, which must already be migrated, and empties
+// every table tests write to before and after the test. Tests using it are skipped when TEST_DB_DSN isn't set.
+func newTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncating these cascades to everything that references them, leaving the seeded permissions and genres
+	truncate := func() {
+		_, err := db.Exec("TRUNCATE users, movies, people, webhook_events, jobs, audit_log RESTART IDENTITY CASCADE")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	truncate()
+
+	t.Cleanup(func() {
+		truncate()
+		db.Close()
+	})
+
+	return db
+}
+
+// newTestApplicationWithDB is a test application with models backed by the test database
+func newTestApplicationWithDB(t *testing.T) *application {
+	app := newTestApplication(t)
+	app.models = data.NewModels(newTestDB(t), []byte("test-cursor-secret"))
+
+	return app
+}
+
+// insertTestUser saves an activated user with the given permissions to the test database
+func insertTestUser(t *testing.T, app *application, email string, permissions ...string) *data.User {
+	user := &data.User{Name: "Test User", Email: email, Locale: "en", Activated: true}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
 	}
+
+	if len(permissions) > 0 {
+		err = app.models.Permissions.AddForUser(user.ID, permissions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return user
+}
+
+// useMemoryMailer replaces the application's mailer with one that keeps what it sends in the returned transport
+func (app *application) useMemoryMailer(t *testing.T) *mailer.MemoryTransport {
+	transport := mailer.NewMemoryTransport()
+
+	m, err := mailer.New(transport, "Greenlight <no-reply@test.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.mailer = m
+
+	return transport
+}
+
+// runQueuedJobs runs the jobs of the kind that are due, the same as a worker would
+func (app *application) runQueuedJobs(t *testing.T, kind string) {
+	jk := app.jobKinds()[kind]
+
+	for {
+		job, err := app.models.Jobs.Claim(kind, time.Minute)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app.runJob(jk, job)
+
+		// Failing records the error on the job
+		if job.Error != "" {
+			t.Fatalf("%s job failed: %s", kind, job.Error)
+		}
+	}
+}
+
+// testUser is an activated user for handlers that need one
+var testUser = &data.User{
+	ID:        1,
+	Name:      "Alice",
+	Email:     "alice@example.com",
+	Locale:    "en",
+	Activated: true,
+}
+
+// serveAs sends the request straight to the handler registered for the route, as the user. The
+// middleware that authenticates the user and checks their permissions is skipped, as it needs a
+// database, so handlers behind it can still be tested up to the point they use the database.
+func (app *application) serveAs(t *testing.T, user *data.User, route string, handler http.HandlerFunc, r *http.Request) (int, http.Header, string) {
+	router := httprouter.New()
+	router.HandlerFunc(r.Method, route, handler)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, app.contextSetUser(r, user))
+
+	rs := rr.Result()
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(body)
 }
 
 type testServer struct {
@@ -49,6 +204,21 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 	return rs.StatusCode, rs.Header, string(body)
 }
 
+func (ts *testServer) post(t *testing.T, urlPath, contentType string, body io.Reader) (int, http.Header, string) {
+	rs, err := ts.Client().Post(ts.URL+urlPath, contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	responseBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(responseBody)
+}
+
 func createExpectedBodyResponse(t *testing.T, code int, data any) string {
 	response := make(map[string]any)
 	response["status"] = Status{Code: code, Message: http.StatusText(code)}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+func (app *application) listMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.GetWithFields(movieID, []string{"id"})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	translations, err := app.models.Translations.GetAllForMovie(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]any{"translations": translations}, nil)
+}
+
+func (app *application) putMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.Translation{
+		MovieID: movieID,
+		Locale:  data.CanonicalLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale")),
+		Title:   input.Title,
+	}
+
+	v := validator.New()
+
+	if translation.Validate(v); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	created, err := app.models.Translations.Put(translation, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	app.serveJSON(w, r, status, translation, nil)
+}
+
+func (app *application) deleteMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	locale := data.CanonicalLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+
+	err = app.models.Translations.Delete(movieID, locale, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "translation successfully deleted"}, nil)
+}
+
+// readAcceptLanguage returns the locales in the Accept-Language header, most preferred first.
+// Wildcards, locales the client has excluded with q=0 and anything malformed are skipped.
+func (app *application) readAcceptLanguage(r *http.Request) []string {
+	type preference struct {
+		locale  string
+		quality float64
+	}
+
+	preferences := []preference{}
+
+	for _, value := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+		locale = data.CanonicalLocale(strings.TrimSpace(locale))
+
+		if !data.ValidLocale(locale) {
+			continue
+		}
+
+		quality := 1.0
+
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			var err error
+
+			quality, err = strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		preferences = append(preferences, preference{locale: locale, quality: quality})
+	}
+
+	// Locales with the same quality keep the order the client listed them in
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	locales := make([]string, len(preferences))
+	for i, preference := range preferences {
+		locales[i] = preference.locale
+	}
+
+	return locales
+}
+
+// localizeMovies replaces the movies' titles with the translations that best match the request's
+// Accept-Language header. Nothing is done if the titles weren't selected.
+func (app *application) localizeMovies(r *http.Request, fields []string, movies ...*data.Movie) error {
+	if len(fields) > 0 && !validator.PermittedValue("title", fields...) {
+		return nil
+	}
+
+	return app.models.Translations.Localize(movies, app.readAcceptLanguage(r))
+}
+
+// localizedHeaders returns the headers for a response whose movies may have been localized
+func localizedHeaders(movies ...*data.Movie) http.Header {
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	// A single movie's response is in the language of its translation, a list can be in several
+	if len(movies) == 1 && movies[0].Locale != "" {
+		headers.Set("Content-Language", movies[0].Locale)
+	}
+
+	return headers
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{name: "no header", header: "", want: []string{}},
+		{name: "single locale", header: "fr", want: []string{"fr"}},
+		{name: "ordered by quality", header: "en;q=0.5, pt-br, fr;q=0.8", want: []string{"pt-BR", "fr", "en"}},
+		{name: "excluded and wildcard skipped", header: "de;q=0, *, es", want: []string{"es"}},
+		{name: "malformed skipped", header: "not a locale, it;q=high, nl", want: []string{"nl"}},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/movies", nil)
+			r.Header.Set("Accept-Language", tt.header)
+
+			assert.Equal(t, tt.want, app.readAcceptLanguage(r))
+		})
+	}
+}
+
+func TestLocalizedResponsesKeepVary(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	rr.Header().Add("Vary", "Authorization")
+
+	app.serveJSON(rr, httptest.NewRequest(http.MethodGet, "/v1/movies", nil), http.StatusOK, nil, localizedHeaders())
+
+	assert.Equal(t, []string{"Authorization", "Accept-Language"}, rr.Header().Values("Vary"))
+}
+
+func TestTranslationsChangeMovieETag(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "The Lion King", Year: 1994, Runtime: 88, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	showMovie := func(etag string) (int, http.Header, string) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+		r.Header.Set("Accept-Language", "fr")
+		r.Header.Set("If-None-Match", etag)
+
+		return app.serveAs(t, data.AnonymousUser, "/v1/movies/:id", app.showMovieHandler, r)
+	}
+
+	putTranslation := func(title string) int {
+		r := httptest.NewRequest(http.MethodPut, "/v1/movies/1/translations/fr", strings.NewReader(`{"title": "`+title+`"}`))
+		code, _, _ := app.serveAs(t, user, "/v1/movies/:id/translations/:locale", app.putMovieTranslationHandler, r)
+		return code
+	}
+
+	_, header, _ := showMovie("")
+	etag := header.Get("ETag")
+
+	code, header, _ := showMovie(etag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+	assert.Equal(t, []string{"Accept-Language"}, header.Values("Vary"))
+
+	assert.Equal(t, http.StatusCreated, putTranslation("Le Roi lion"))
+
+	code, header, body := showMovie(etag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Le Roi lion")
+
+	// Putting the same title again isn't a change
+	etag = header.Get("ETag")
+
+	assert.Equal(t, http.StatusOK, putTranslation("Le Roi lion"))
+
+	code, _, _ = showMovie(etag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/movies/1/translations/fr", nil)
+	code, _, _ = app.serveAs(t, user, "/v1/movies/:id/translations/:locale", app.deleteMovieTranslationHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _, body = showMovie(etag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "The Lion King")
+
+	updated, err := app.models.Movies.Get(movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int32(3), updated.Version)
+}
+
+func TestShowMovieETagDependsOnLanguage(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "The Lion King", Year: 1994, Runtime: 88, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.models.Translations.Put(&data.Translation{MovieID: movie.ID, Locale: "fr", Title: "Le Roi lion"}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	showMovie := func(language, etag string) (int, http.Header, string) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+		r.Header.Set("Accept-Language", language)
+		r.Header.Set("If-None-Match", etag)
+
+		return app.serveAs(t, data.AnonymousUser, "/v1/movies/:id", app.showMovieHandler, r)
+	}
+
+	_, header, _ := showMovie("fr", "")
+	frenchETag := header.Get("ETag")
+
+	code, header, _ := showMovie("fr", frenchETag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+	assert.Equal(t, "fr", header.Get("Content-Language"))
+
+	// The French copy mustn't be confirmed as current for a client asking for English
+	code, header, body := showMovie("en", frenchETag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "The Lion King")
+	assert.NotEqual(t, frenchETag, header.Get("ETag"))
+
+	// Either language's ETag can be used to update the movie
+	r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(`{"runtime": "89 mins"}`))
+	r.Header.Set("If-Match", frenchETag)
+
+	code, _, _ = app.serveAs(t, user, "/v1/movies/:id", app.updateMovieHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// purgeTrash permanently deletes movies that have been in the trash for longer than the
+// configured retention period, checking every purge interval until the context is cancelled
+func (app *application) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purgeDeletedMovies(ctx)
+		}
+	}
+}
+
+// purgeDeletedMovies deletes the movies past the retention period, along with their posters
+func (app *application) purgeDeletedMovies(ctx context.Context) {
+	purged, posters, err := app.models.Movies.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	// The movies are already gone, so a poster that can't be deleted is only logged
+	for _, poster := range posters {
+		for _, key := range []string{poster.Key(), poster.ThumbnailKey()} {
+			err := app.blobs.Delete(ctx, key)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"key": key})
+			}
+		}
+	}
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged movies from the trash", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDeletedMoviesValidatesFilters(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/trash?page=0&page_size=101", nil)
+
+	code, _, body := app.serveAs(t, testUser, "/v1/movies/trash", app.listDeletedMoviesHandler, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnprocessableEntity, map[string]any{
+		"error": map[string]string{
+			"page":      "must be greater than zero",
+			"page_size": "must be a maximum of 100",
+		},
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestRestoreMovie(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/movies/1/restore", nil)
+
+	code, _, _ := app.serveAs(t, user, "/v1/movies/:id/restore", app.restoreMovieHandler, r)
+
+	// Only movies in the trash can be restored
+	assert.Equal(t, http.StatusNotFound, code)
+
+	err = app.models.Movies.Delete(movie.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.models.Movies.Get(movie.ID)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/movies/1/restore", nil)
+
+	code, header, _ := app.serveAs(t, user, "/v1/movies/:id/restore", app.restoreMovieHandler, r)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, movieETag(&data.Movie{Version: movie.Version + 2}), header.Get("ETag"))
+
+	restored, err := app.models.Movies.Get(movie.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Moana", restored.Title)
+}
+
+func TestPurgeDeletedMoviesDeletesPosters(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "editor@example.com", data.PermissionMoviesWrite)
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+
+	// Both movies get a poster, but only the first is put in the trash
+	var posters []data.Poster
+
+	for i, title := range []string{"Moana", "Frozen"} {
+		movie := &data.Movie{Title: title, Year: 2016, Runtime: 107, Genres: []string{"animation"}}
+
+		err := app.models.Movies.Insert(movie, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		poster := data.Poster(strings.ToLower(title) + ".png")
+
+		for _, key := range []string{poster.Key(), poster.ThumbnailKey()} {
+			err := blobs.Put(context.Background(), key, strings.NewReader("poster"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = app.models.Movies.SetPoster(movie, poster, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			err = app.models.Movies.Delete(movie.ID, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		posters = append(posters, poster)
+	}
+
+	app.config.trash.retention = 0
+
+	app.purgeDeletedMovies(context.Background())
+
+	for _, key := range []string{posters[0].Key(), posters[0].ThumbnailKey()} {
+		_, _, err := blobs.Get(context.Background(), key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+
+	for _, key := range []string{posters[1].Key(), posters[1].ThumbnailKey()} {
+		rc, _, err := blobs.Get(context.Background(), key)
+		if assert.NoError(t, err, key) {
+			rc.Close()
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"net/http"
 	"time"
 
 	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
 	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
 )
 
@@ -13,6 +16,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	var input struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
+		Locale   string `json:"locale"`
 		Password string `json:"password"`
 	}
 
@@ -22,9 +26,18 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Without a locale, emails are sent in the language the user's client prefers
+	if input.Locale == "" {
+		input.Locale = mailer.DefaultLocale
+		if preferences := app.readAcceptLanguage(r); len(preferences) > 0 {
+			input.Locale = preferences[0]
+		}
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
+		Locale:    data.CanonicalLocale(input.Locale),
 		Activated: false,
 	}
 
@@ -41,7 +54,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// The welcome email is queued with the user, so a user is never left without one
+	err = app.models.Transaction(r.Context(), func(ctx context.Context, tx *sql.Tx) error {
+		err := app.models.Users.InsertTx(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueJobTx(ctx, tx, jobSendWelcomeEmail, welcomeEmailJob{UserID: user.ID})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -53,28 +74,67 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// TODO Reduce this time to 1 hour and update user_welcome template
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	app.serveJSON(w, r, http.StatusAccepted, user, nil)
+}
+
+type welcomeEmailJob struct {
+	UserID int64 `json:"userId"`
+}
+
+// sendWelcomeEmail sends a new user their activation token. The token is only created when the
+// email is sent, so it's never stored anywhere in plaintext.
+func (app *application) sendWelcomeEmail(ctx context.Context, job welcomeEmailJob) error {
+	var user *data.User
+	var token *data.Token
+
+	err := app.models.Transaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+
+		user, err = app.models.Users.GetTx(ctx, tx, job.UserID)
+		if err != nil {
+			return err
+		}
 
-	app.background(func() {
-		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
+		if user.Activated {
+			return nil
 		}
 
-		if app.mailer.Send(user.Email, "user_welcome.html", data); err == nil {
-			properties := map[string]string{"email": user.Email}
-			app.logger.PrintInfo("sent welcome email to user", properties)
-		} else {
-			app.logger.PrintError(err, nil)
+		// Tokens created by earlier attempts are replaced, so retries don't leave them piling up
+		err = app.models.Tokens.DeleteAllForUserTx(ctx, tx, data.ScopeActivation, user.ID)
+		if err != nil {
+			return err
 		}
+
+		// TODO Reduce this time to 1 hour and update user_welcome template
+		token, err = app.models.Tokens.NewTx(ctx, tx, user.ID, 3*24*time.Hour, data.ScopeActivation)
+		return err
 	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
 
-	app.serveJSON(w, r, http.StatusAccepted, user, nil)
+	if user.Activated {
+		return nil
+	}
+
+	email := mailer.UserWelcome{
+		Name:            user.Name,
+		ActivationToken: token.Plaintext,
+	}
+
+	err = app.mailer.Send(ctx, user.Email, user.Locale, email)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("sent welcome email to user", map[string]string{"email": user.Email})
+
+	return nil
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -108,9 +168,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user.Activated = true
-
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Activate(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
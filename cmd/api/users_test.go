@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWelcomeEmailContainsActivationToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		locale      string
+		wantSubject string
+		wantLang    string
+	}{
+		{name: "default locale", locale: "en", wantSubject: "Welcome to Greenlight!", wantLang: `lang="en"`},
+		{name: "translated locale", locale: "fr", wantSubject: "Bienvenue sur Greenlight !", wantLang: `lang="fr"`},
+		{name: "translated language", locale: "fr-CA", wantSubject: "Bienvenue sur Greenlight !", wantLang: `lang="fr"`},
+		{name: "untranslated locale", locale: "pt-BR", wantSubject: "Welcome to Greenlight!", wantLang: `lang="en"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplicationWithDB(t)
+			transport := app.useMemoryMailer(t)
+
+			body := strings.NewReader(`{"name": "Alice", "email": "alice@example.com", "locale": "` + tt.locale + `", "password": "pa55word1234"}`)
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", body)
+
+			code, _, _ := app.serveAs(t, data.AnonymousUser, "/v1/users", app.registerUserHandler, r)
+
+			assert.Equal(t, http.StatusAccepted, code)
+
+			app.runQueuedJobs(t, jobSendWelcomeEmail)
+
+			messages := transport.Messages()
+			if assert.Len(t, messages, 1) {
+				assert.Equal(t, "alice@example.com", messages[0].To)
+				assert.Equal(t, tt.wantSubject, messages[0].Subject)
+				assert.Contains(t, messages[0].PlainBody, "Alice")
+				assert.Contains(t, messages[0].HTMLBody, tt.wantLang)
+			}
+
+			// The token in the email is the one that activates the new user
+			token := sentToken(t, transport, "alice@example.com")
+
+			user, err := app.models.Users.GetForToken(data.ScopeActivation, token)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "alice@example.com", user.Email)
+			}
+		})
+	}
+}
+
+func TestRegisterUserQueuesWelcomeEmail(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+
+	register := func() int {
+		body := strings.NewReader(`{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`)
+		r := httptest.NewRequest(http.MethodPost, "/v1/users", body)
+
+		code, _, _ := app.serveAs(t, data.AnonymousUser, "/v1/users", app.registerUserHandler, r)
+		return code
+	}
+
+	assert.Equal(t, http.StatusAccepted, register())
+
+	job, err := app.models.Jobs.Claim(jobSendWelcomeEmail, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload welcomeEmailJob
+
+	err = json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int64(1), payload.UserID)
+
+	// A registration that's rejected doesn't leave a job behind
+	assert.Equal(t, http.StatusUnprocessableEntity, register())
+
+	_, err = app.models.Jobs.Claim(jobSendWelcomeEmail, time.Minute)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+}
+
+func TestWelcomeEmailRetryReplacesToken(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	transport := app.useMemoryMailer(t)
+
+	user := &data.User{Name: "Alice", Email: "alice@example.com", Locale: "en"}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As if the first email was sent but the job failed before it was recorded
+	for i := 0; i < 2; i++ {
+		err := app.sendWelcomeEmail(context.Background(), welcomeEmailJob{UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := transport.Messages()
+	if !assert.Len(t, messages, 2) {
+		return
+	}
+
+	first := tokenRX.FindStringSubmatch(messages[0].PlainBody)[1]
+	second := sentToken(t, transport, "alice@example.com")
+
+	_, err = app.models.Users.GetForToken(data.ScopeActivation, first)
+	assert.ErrorIs(t, err, data.ErrRecordNotFound)
+
+	_, err = app.models.Users.GetForToken(data.ScopeActivation, second)
+	assert.NoError(t, err)
+
+	// A job that has run out of time gives up rather than carrying on past its lease
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = app.sendWelcomeEmail(ctx, welcomeEmailJob{UserID: user.ID})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, transport.Messages(), 2)
+}
+
+func TestSMTPTransportStopsWhenContextIsDone(t *testing.T) {
+	transport := mailer.NewSMTPTransport("localhost", 2525, "", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := transport.Send(ctx, &mailer.Message{To: "alice@example.com"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
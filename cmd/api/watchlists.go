@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+// The handlers below are shared between the watchlist and watched lists, with the list
+// they act on chosen when the routes are registered
+
+func (app *application) listMovieListHandler(list data.MovieList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			data.Filters
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Filters.Page = app.readInt(qs, "page", 1, v)
+		input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+		input.Filters.Sort = app.readString(qs, "sort", "-added_at")
+		input.Filters.SortSafeList = []string{
+			"added_at", "title", "year", "runtime", "rating", "-added_at", "-title", "-year", "-runtime", "-rating",
+		}
+
+		if input.Filters.Validate(v); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		entries, pageInfo, err := app.models.Watchlists.GetAll(list, app.contextGetUser(r).ID, input.Filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		data := map[string]any{"movies": entries, "pageInfo": pageInfo}
+
+		app.serveJSON(w, r, http.StatusOK, data, nil)
+	}
+}
+
+func (app *application) showMovieListEntryHandler(list data.MovieList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := app.readNamedIDParam(r, "movie_id")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		entry, err := app.models.Watchlists.Get(list, app.contextGetUser(r).ID, movieID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.serveJSON(w, r, http.StatusOK, entry, nil)
+	}
+}
+
+// addMovieListEntryHandler is idempotent, responding with 201 the first time a movie is
+// added to the list and 200 if it's already on there
+func (app *application) addMovieListEntryHandler(list data.MovieList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := app.readNamedIDParam(r, "movie_id")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		added, err := app.models.Watchlists.Add(list, app.contextGetUser(r).ID, movieID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		status := http.StatusOK
+		if added {
+			status = http.StatusCreated
+		}
+
+		app.serveJSON(w, r, status, map[string]string{"message": "movie added to " + string(list)}, nil)
+	}
+}
+
+func (app *application) removeMovieListEntryHandler(list data.MovieList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		movieID, err := app.readNamedIDParam(r, "movie_id")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		err = app.models.Watchlists.Remove(list, app.contextGetUser(r).ID, movieID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.serveJSON(w, r, http.StatusOK, map[string]string{"message": "movie removed from " + string(list)}, nil)
+	}
+}
+
+// showsOnWatchlist reports whether responses to the request flag the movies on the user's watchlist,
+// which they do for authenticated users unless the flag is left out of a sparse fieldset
+func (app *application) showsOnWatchlist(r *http.Request, fields []string) bool {
+	if app.contextGetUser(r).IsAnonymous() {
+		return false
+	}
+
+	return len(fields) == 0 || validator.PermittedValue(data.MovieFieldOnWatchlist, fields...)
+}
+
+// setOnWatchlist flags whether each movie is on the authenticated user's watchlist.
+// Nothing is set for anonymous users, so the flag is left out of their responses.
+func (app *application) setOnWatchlist(r *http.Request, fields []string, movies ...*data.Movie) error {
+	if !app.showsOnWatchlist(r, fields) || len(movies) == 0 {
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+
+	movieIDs := make([]int64, len(movies))
+	for i, movie := range movies {
+		movieIDs[i] = movie.ID
+	}
+
+	onWatchlist, err := app.models.Watchlists.Contains(data.ListWatchlist, user.ID, movieIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		flag := onWatchlist[movie.ID]
+		movie.OnWatchlist = &flag
+	}
+
+	return nil
+}
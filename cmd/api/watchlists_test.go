@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchlistRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/users/me/watchlist")
+
+	assert.Equal(t, http.StatusUnauthorized, code)
+	expected_body := createExpectedBodyResponse(t, http.StatusUnauthorized, map[string]any{
+		"error": "you must be authenticated to access this resource",
+	})
+
+	assert.JSONEq(t, expected_body, body)
+}
+
+func TestMovieSelectFieldsOnWatchlist(t *testing.T) {
+	onWatchlist := true
+	movie := &data.Movie{ID: 1, Title: "Moana", OnWatchlist: &onWatchlist}
+
+	assert.Equal(t, map[string]any{"title": "Moana"}, movie.SelectFields([]string{"title"}))
+	assert.Equal(t, map[string]any{"title": "Moana", "onWatchlist": true}, movie.SelectFields([]string{"title", "onWatchlist"}))
+
+	// Anonymous users never have the flag set
+	movie.OnWatchlist = nil
+
+	assert.Equal(t, map[string]any{"title": "Moana"}, movie.SelectFields([]string{"title", "onWatchlist"}))
+}
+
+func TestShowMovieOnWatchlistIsNeverNotModified(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "viewer@example.com")
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	showMovie := func(user *data.User, etag string) (int, string, map[string]any) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+		r.Header.Set("If-None-Match", etag)
+
+		code, header, body := app.serveAs(t, user, "/v1/movies/:id", app.showMovieHandler, r)
+
+		var response struct {
+			Data map[string]any `json:"data"`
+		}
+
+		if code == http.StatusOK {
+			err := json.Unmarshal([]byte(body), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return code, header.Get("ETag"), response.Data
+	}
+
+	code, etag, movieData := showMovie(user, "")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, movieData["onWatchlist"])
+
+	_, err = app.models.Watchlists.Add(data.ListWatchlist, user.ID, movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The movie hasn't changed, but whether it's on the user's watchlist has
+	code, _, movieData = showMovie(user, etag)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, movieData["onWatchlist"])
+
+	code, _, _ = showMovie(data.AnonymousUser, etag)
+
+	assert.Equal(t, http.StatusNotModified, code)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+)
+
+const (
+	webhookDispatchBatchSize = 100
+	webhookBaseBackoff       = 30 * time.Second
+	webhookMaxBackoff        = 6 * time.Hour
+	webhookCleanupInterval   = time.Hour
+)
+
+// dispatchWebhookEvents moves events out of the outbox into deliveries for the webhooks
+// subscribed to them, checking every poll interval until the context is cancelled
+func (app *application) dispatchWebhookEvents(ctx context.Context) {
+	ticker := time.NewTicker(app.config.webhooks.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going while there are full batches, rather than waiting for the next tick
+			for ctx.Err() == nil {
+				dispatched, err := app.models.Webhooks.DispatchEvents(webhookDispatchBatchSize)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					break
+				}
+
+				if dispatched < webhookDispatchBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// cleanUpWebhookEvents deletes events whose deliveries have all finished once they're older than
+// the retention period, checking every cleanup interval until the context is cancelled
+func (app *application) cleanUpWebhookEvents(ctx context.Context) {
+	ticker := time.NewTicker(webhookCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := app.models.Webhooks.DeleteFinishedEvents(app.config.webhooks.eventRetention)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			if deleted > 0 {
+				app.logger.PrintInfo("deleted finished webhook events", map[string]string{
+					"count": strconv.FormatInt(deleted, 10),
+				})
+			}
+		}
+	}
+}
+
+// deliverWebhooks sends deliveries as they become due, until the context is cancelled.
+// Several of these run at once, each claiming its own deliveries.
+func (app *application) deliverWebhooks(ctx context.Context) {
+	client := newWebhookClient(app.config.webhooks.timeout)
+
+	// A claimed delivery isn't attempted again until its lease runs out, which leaves
+	// plenty of time for the request to finish and its outcome to be recorded
+	lease := 2 * app.config.webhooks.timeout
+
+	ticker := time.NewTicker(app.config.webhooks.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				delivery, err := app.models.Webhooks.ClaimDelivery(lease)
+				if err != nil {
+					if !errors.Is(err, data.ErrRecordNotFound) {
+						app.logger.PrintError(err, nil)
+					}
+					break
+				}
+
+				app.attemptWebhookDelivery(ctx, client, delivery)
+			}
+		}
+	}
+}
+
+// newWebhookClient returns the client deliveries are sent with. It refuses to connect to
+// internal addresses, since a webhook's hostname can resolve to one after it was validated.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !data.PublicIP(ip) {
+				return fmt.Errorf("refusing to connect to internal address %s", host)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Going through a proxy would mean the dialer only ever checks the proxy's address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// Redirects aren't followed, receivers should be configured with the URL they're served at
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// attemptWebhookDelivery sends the delivery and records the outcome, scheduling a retry with
+// exponential backoff if it failed and has attempts left
+func (app *application) attemptWebhookDelivery(ctx context.Context, client *http.Client, delivery *data.WebhookDelivery) {
+	status, err := sendWebhook(ctx, client, delivery, time.Now())
+
+	if status != 0 {
+		responseStatus := int32(status)
+		delivery.ResponseStatus = &responseStatus
+	}
+
+	var retryAt *time.Time
+
+	if err != nil {
+		delivery.Error = err.Error()
+
+		if int(delivery.Attempts) < app.config.webhooks.maxAttempts {
+			next := time.Now().Add(webhookBackoff(int(delivery.Attempts)))
+			retryAt = &next
+		}
+	}
+
+	err = app.models.Webhooks.RecordAttempt(delivery, retryAt)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if delivery.Status == data.DeliveryStatusFailed {
+		app.logger.PrintInfo("webhook delivery failed", map[string]string{
+			"delivery": strconv.FormatInt(delivery.ID, 10),
+			"webhook":  strconv.FormatInt(delivery.WebhookID, 10),
+			"error":    delivery.Error,
+		})
+	}
+}
+
+// webhookBackoff returns how long to wait before the next attempt, doubling after each one
+func webhookBackoff(attempts int) time.Duration {
+	return exponentialBackoff(webhookBaseBackoff, webhookMaxBackoff, attempts)
+}
+
+// sendWebhook posts the delivery's event to the webhook, returning the response's status
+// code, if there was a response, and an error unless the receiver responded with a 2xx
+func sendWebhook(ctx context.Context, client *http.Client, delivery *data.WebhookDelivery, now time.Time) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lets-go-further-webhooks/"+version)
+	req.Header.Set("Webhook-Id", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("Webhook-Event", delivery.Event.Type)
+	req.Header.Set("Webhook-Timestamp", timestamp)
+	req.Header.Set("Webhook-Signature", "sha256="+signWebhook(delivery.Secret, timestamp, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain some of the body so the connection can be reused, without letting a receiver make us read forever
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// signWebhook returns the hex encoded HMAC-SHA256 of the timestamp and body. The timestamp is
+// signed too, so receivers can reject old deliveries being replayed at them.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/data"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendWebhook(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := &data.WebhookDelivery{
+		ID:     7,
+		URL:    receiver.URL,
+		Secret: "a-very-secret-secret",
+		Event: &data.WebhookEvent{
+			ID:   3,
+			Type: data.EventMovieCreated,
+			Data: json.RawMessage(`{"id":1,"version":1}`),
+		},
+	}
+
+	now := time.Unix(1700000000, 0)
+
+	status, err := sendWebhook(context.Background(), receiver.Client(), delivery, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	assert.Equal(t, "movie.created", received.Header.Get("Webhook-Event"))
+	assert.Equal(t, "7", received.Header.Get("Webhook-Id"))
+	assert.Equal(t, "1700000000", received.Header.Get("Webhook-Timestamp"))
+	assert.Equal(t, "sha256="+signWebhook(delivery.Secret, "1700000000", receivedBody), received.Header.Get("Webhook-Signature"))
+	assert.JSONEq(t, `{"id":3,"type":"movie.created","createdAt":"0001-01-01T00:00:00Z","data":{"id":1,"version":1}}`, string(receivedBody))
+}
+
+func TestSendWebhookFailsOnErrorStatus(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	delivery := &data.WebhookDelivery{
+		URL:   receiver.URL,
+		Event: &data.WebhookEvent{Type: data.EventMovieDeleted, Data: json.RawMessage(`{}`)},
+	}
+
+	status, err := sendWebhook(context.Background(), receiver.Client(), delivery, time.Now())
+
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.EqualError(t, err, "receiver responded with status 500")
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := &data.WebhookDelivery{
+		URL:   receiver.URL,
+		Event: &data.WebhookEvent{Type: data.EventMovieCreated, Data: json.RawMessage(`{}`)},
+	}
+
+	status, err := sendWebhook(context.Background(), newWebhookClient(time.Second), delivery, time.Now())
+
+	assert.Equal(t, 0, status)
+	assert.ErrorContains(t, err, "refusing to connect to internal address 127.0.0.1")
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://example.com/hooks", valid: true},
+		{url: "http://93.184.216.34:8080/hooks", valid: true},
+		{url: "ftp://example.com/hooks"},
+		{url: "http://localhost:4000/hooks"},
+		{url: "http://api.localhost/hooks"},
+		{url: "http://127.0.0.1/hooks"},
+		{url: "http://10.0.0.5/hooks"},
+		{url: "http://192.168.1.1/hooks"},
+		{url: "http://100.64.0.1/hooks"},
+		{url: "http://100.127.255.254/hooks"},
+		{url: "http://100.128.0.1/hooks", valid: true},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "http://0.0.0.0/hooks"},
+		{url: "http://[::1]/hooks"},
+		{url: "http://[fe80::1]/hooks"},
+		{url: "http://[::ffff:127.0.0.1]/hooks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			webhook := data.Webhook{URL: tt.url, Secret: "0123456789abcdef", Events: []string{data.EventMovieCreated}}
+			v := validator.New()
+
+			webhook.Validate(v)
+
+			assert.Equal(t, tt.valid, v.Valid(), v.Errors)
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhookBackoff(1))
+	assert.Equal(t, 2*time.Minute, webhookBackoff(3))
+	assert.Equal(t, 6*time.Hour, webhookBackoff(20))
+}
+
+func TestWebhookReceivesSubscribedEvents(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+
+	user := insertTestUser(t, app, "hooks@example.com", data.PermissionWebhooksManage, data.PermissionMoviesWrite)
+	other := insertTestUser(t, app, "other@example.com", data.PermissionWebhooksManage)
+
+	body := strings.NewReader(`{"url": "https://example.com/hooks", "secret": "0123456789abcdef", "events": ["movie.created"]}`)
+	r := httptest.NewRequest(http.MethodPost, "/v1/webhooks", body)
+
+	code, header, _ := app.serveAs(t, user, "/v1/webhooks", app.createWebhookHandler, r)
+
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "/v1/webhooks/1", header.Get("Location"))
+
+	// Webhooks are only visible to the user who created them
+	r = httptest.NewRequest(http.MethodGet, "/v1/webhooks/1", nil)
+	code, _, _ = app.serveAs(t, other, "/v1/webhooks/:id", app.showWebhookHandler, r)
+
+	assert.Equal(t, http.StatusNotFound, code)
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"drama"}}
+
+	err := app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the events the webhook subscribed to are delivered to it
+	err = app.models.Movies.Delete(movie.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatched, err := app.models.Webhooks.DispatchEvents(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int64(2), dispatched)
+
+	deliveries, _, err := app.models.Webhooks.GetDeliveries(1, data.Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, data.EventMovieCreated, deliveries[0].Event.Type)
+		assert.Equal(t, data.DeliveryStatusPending, deliveries[0].Status)
+		assert.JSONEq(t, `{"id": 1, "version": 1}`, string(deliveries[0].Event.Data))
+	}
+}
+
+func TestDeleteFinishedWebhookEvents(t *testing.T) {
+	app := newTestApplicationWithDB(t)
+	user := insertTestUser(t, app, "hooks@example.com", data.PermissionWebhooksManage, data.PermissionMoviesWrite)
+
+	webhook := &data.Webhook{UserID: user.ID, URL: "https://example.com/hooks", Secret: "0123456789abcdef", Events: []string{data.EventMovieCreated}}
+
+	err := app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movie := &data.Movie{Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"drama"}}
+
+	err = app.models.Movies.Insert(movie, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.models.Webhooks.DispatchEvents(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are kept while their deliveries are pending
+	deleted, err := app.models.Webhooks.DeleteFinishedEvents(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	delivery, err := app.models.Webhooks.ClaimDelivery(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Webhooks.RecordAttempt(delivery, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and for the retention period once they've finished
+	deleted, err = app.models.Webhooks.DeleteFinishedEvents(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	deleted, err = app.models.Webhooks.DeleteFinishedEvents(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deliveries, _, err := app.models.Webhooks.GetDeliveries(webhook.ID, data.Filters{Page: 1, PageSize: 20})
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
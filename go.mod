@@ -9,12 +9,14 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/crypto v0.5.0 // indirect
-	golang.org/x/time v0.3.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-require github.com/lib/pq v1.10.2
+require (
+	github.com/go-mail/mail/v2 v2.3.0
+	github.com/lib/pq v1.10.2
+	golang.org/x/crypto v0.5.0
+	golang.org/x/time v0.3.0
+)
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditUserActivated      = "user.activated"
+	AuditUserDeactivated    = "user.deactivated"
+	AuditPasswordReset      = "user.password_reset"
+	AuditTokensRevoked      = "user.tokens_revoked"
+	AuditPermissionsChanged = "user.permissions_changed"
+)
+
+// AuditEntry records an action an admin took on a user. The actor and user are kept as null
+// once they're deleted, so the details include anything needed to tell who the user was.
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	ActorID   *int64         `json:"actorId"`
+	Action    string         `json:"action"`
+	UserID    *int64         `json:"userId"`
+	Details   map[string]any `json:"details"`
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// InsertTx records the action in the transaction making the change, so an action is recorded
+// if and only if it was committed
+func (m AuditModel) InsertTx(ctx context.Context, tx *sql.Tx, actorID int64, action string, userID int64, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+
+	js, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO audit_log (actor_id, action, user_id, details)
+        VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = tx.ExecContext(ctx, query, actorID, action, userID, string(js))
+	return err
+}
+
+// GetAll returns the audit log, most recent first, only including the entries about the user if userID isn't zero
+func (m AuditModel) GetAll(userID int64, filters Filters) ([]*AuditEntry, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), id, created_at, actor_id, action, user_id, details
+        FROM audit_log
+        WHERE (user_id = $1 OR $1 = 0)
+        ORDER BY id DESC
+        LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		var entry AuditEntry
+		var details []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.UserID,
+			&details,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		err = json.Unmarshal(details, &entry.Details)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, pageInfo, nil
+}
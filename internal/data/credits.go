@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+	ErrPersonNotFound  = errors.New("person not found")
+)
+
+const (
+	CreditRoleDirector = "director"
+	CreditRoleWriter   = "writer"
+	CreditRoleActor    = "actor"
+)
+
+// Credit records the role a person had in making a movie
+type Credit struct {
+	ID       int64  `json:"id"`
+	MovieID  int64  `json:"movieId"`
+	PersonID int64  `json:"personId"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	// Character is the name of the character played, only actors have one
+	Character string `json:"character,omitempty"`
+}
+
+func (c Credit) Validate(v *validator.Validator) {
+	v.Check(c.PersonID != 0, "personId", "must be provided")
+	v.Check(c.PersonID > 0, "personId", "must be a positive integer")
+
+	v.Check(c.Role != "", "role", "must be provided")
+	v.Check(
+		validator.PermittedValue(c.Role, CreditRoleDirector, CreditRoleWriter, CreditRoleActor),
+		"role",
+		"must be one of director, writer or actor",
+	)
+
+	if c.Role == CreditRoleActor {
+		v.Check(c.Character != "", "character", "must be provided for an actor")
+	} else {
+		v.Check(c.Character == "", "character", "must only be provided for an actor")
+	}
+	v.Check(len(c.Character) <= 500, "character", "must not be more than 500 bytes long")
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the credit to the movie, returning ErrRecordNotFound if the movie doesn't exist
+// and ErrPersonNotFound if the person doesn't
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+        WITH movie AS (
+            SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL
+        ), person AS (
+            SELECT id, name FROM people WHERE id = $2
+        ), inserted AS (
+            INSERT INTO credits (movie_id, person_id, role, character)
+            SELECT movie.id, person.id, $3, $4
+            FROM movie, person
+            RETURNING id
+        )
+        SELECT EXISTS (SELECT 1 FROM movie), (SELECT name FROM person), (SELECT id FROM inserted)
+	`
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character}
+
+	var movieFound bool
+	var name sql.NullString
+	var id sql.NullInt64
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movieFound, &name, &id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case !movieFound:
+		return ErrRecordNotFound
+	case !name.Valid:
+		return ErrPersonNotFound
+	}
+
+	credit.ID = id.Int64
+	credit.Name = name.String
+
+	return nil
+}
+
+// GetAllForMovie returns the movie's credits, with directors first, then writers, then actors
+func (m CreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+	query := `
+        SELECT credits.id, movie_id, person_id, people.name, role, character
+        FROM credits
+        INNER JOIN people ON people.id = credits.person_id
+        WHERE movie_id = $1
+        ORDER BY array_position(ARRAY['director', 'writer', 'actor'], role), credits.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Name,
+			&credit.Role,
+			&credit.Character,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m CreditModel) Delete(movieID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM credits
+        WHERE id = $1 AND movie_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
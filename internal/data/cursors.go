@@ -0,0 +1,84 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a position in a sorted list of records. It holds the value of the sort
+// column and the id of the record the next page should start after (or before, if
+// Backwards is set), so pages stay consistent when rows are inserted in the meantime.
+type cursor struct {
+	Sort      string `json:"s"`
+	Value     string `json:"v"`
+	ID        int64  `json:"i"`
+	Backwards bool   `json:"b,omitempty"`
+}
+
+// encodeCursor serializes the cursor and signs it, so clients can pass it back
+// but can't forge one pointing at arbitrary values
+func encodeCursor(secret []byte, c cursor) string {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		// Marshalling a struct of strings, ints and bools can't fail
+		panic(err)
+	}
+
+	encoding := base64.RawURLEncoding
+
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(sign(secret, payload))
+}
+
+func decodeCursor(secret []byte, s string) (cursor, error) {
+	var c cursor
+
+	encodedPayload, encodedSignature, found := strings.Cut(s, ".")
+	if !found {
+		return c, ErrInvalidCursor
+	}
+
+	encoding := base64.RawURLEncoding
+
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if !hmac.Equal(signature, sign(secret, payload)) {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// cursorPosition decodes the filters' cursor, rejecting one that was issued for a
+// different sort since its value would be compared against the wrong column
+func (f Filters) cursorPosition(secret []byte) (cursor, error) {
+	c, err := decodeCursor(secret, f.Cursor)
+	if err != nil || c.Sort != f.Sort {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func sign(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	secret := []byte("cursor-secret")
+
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{"Forwards", cursor{Sort: "title", Value: "Moana", ID: 12}},
+		{"Backwards", cursor{Sort: "-year", Value: "2016", ID: 3, Backwards: true}},
+		{"Empty value", cursor{Sort: "id", Value: "", ID: 1}},
+		{"Value with separators", cursor{Sort: "title", Value: "a.b/c+d=e", ID: 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(secret, tt.cursor)
+
+			decoded, err := decodeCursor(secret, encoded)
+			require.NoError(t, err)
+			assert.Equal(t, tt.cursor, decoded)
+		})
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	secret := []byte("cursor-secret")
+	encoding := base64.RawURLEncoding
+
+	valid := encodeCursor(secret, cursor{Sort: "title", Value: "Moana", ID: 12})
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	forgedPayload := encoding.EncodeToString([]byte(`{"s":"title","v":"Zootopia","i":99}`))
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"Empty", ""},
+		{"No separator", payload + signature},
+		{"Payload not base64", "!!!." + signature},
+		{"Signature not base64", payload + ".!!!"},
+		{"Forged payload", forgedPayload + "." + signature},
+		{"Truncated signature", payload + "." + signature[:len(signature)-2]},
+		{"Signed with another secret", encodeCursor([]byte("other-secret"), cursor{Sort: "title", Value: "Moana", ID: 12})},
+		{"Signed payload that isn't JSON", encoding.EncodeToString([]byte("nope")) + "." + encoding.EncodeToString(sign(secret, []byte("nope")))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(secret, tt.cursor)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestCursorPosition(t *testing.T) {
+	secret := []byte("cursor-secret")
+	issued := cursor{Sort: "-year", Value: "2016", ID: 3}
+
+	tests := []struct {
+		name    string
+		sort    string
+		cursor  string
+		wantErr error
+	}{
+		{"Same sort", "-year", encodeCursor(secret, issued), nil},
+		{"Reversed sort", "year", encodeCursor(secret, issued), ErrInvalidCursor},
+		{"Different column", "title", encodeCursor(secret, issued), ErrInvalidCursor},
+		{"Invalid cursor", "-year", "garbage", ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Sort: tt.sort, Cursor: tt.cursor}
+
+			c, err := filters.cursorPosition(secret)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, issued, c)
+		})
+	}
+}
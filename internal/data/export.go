@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const exportBatchSize = 500
+
+// Export passes every movie matching the query to fn, in the order given by the filters'
+// sort. Movies are fetched in batches through a server-side cursor, so memory use stays
+// flat however large the catalogue is. Paging in the filters is ignored.
+func (m MovieModel) Export(ctx context.Context, movieQuery MovieQuery, filters Filters, fn func(*Movie) error) error {
+	args := queryArgs{}
+
+	conditions := movieQuery.conditions(&args)
+	orderBy := movieQuery.orderBy(&args, filters, false)
+
+	fields := movieQuery.Fields
+	if len(fields) == 0 {
+		fields = MovieFieldSafeList
+	}
+
+	columns := selectColumns(fields, "id")
+
+	query := fmt.Sprintf(`
+        DECLARE movies_export NO SCROLL CURSOR FOR
+        SELECT %s
+        FROM movies
+		WHERE %s
+        ORDER BY %s`,
+		strings.Join(columns, ", "),
+		strings.Join(conditions, "\n\t\tAND "),
+		orderBy,
+	)
+
+	var tx *sql.Tx
+	var err error
+
+	// Cursors only exist for the lifetime of the transaction they were declared in
+	if movieQuery.Fuzzy {
+		tx, err = m.beginFuzzyTx(ctx, movieQuery.SimilarityThreshold)
+	} else {
+		tx, err = m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	}
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportBatchSize)
+
+	for {
+		fetched, err := m.exportBatch(ctx, tx, fetch, columns, fn)
+		if err != nil {
+			return err
+		}
+
+		if fetched < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+func (m MovieModel) exportBatch(ctx context.Context, tx *sql.Tx, fetch string, columns []string, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	fetched := 0
+
+	for rows.Next() {
+		var movie Movie
+
+		destinations := make([]any, len(columns))
+		for i, column := range columns {
+			destinations[i] = movie.columnDestination(column)
+		}
+
+		err := rows.Scan(destinations...)
+		if err != nil {
+			return 0, err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return 0, err
+		}
+
+		fetched++
+	}
+
+	return fetched, rows.Err()
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"fmt"
 	"math"
 	"strings"
 
@@ -12,6 +13,7 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       string
 }
 
 func (f Filters) Validate(v *validator.Validator) {
@@ -21,6 +23,8 @@ func (f Filters) Validate(v *validator.Validator) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	v.Check(f.Cursor == "" || f.Page == 1, "cursor", "must not be combined with page")
 }
 
 func (f Filters) sortColumn() string {
@@ -41,6 +45,55 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// orderBy returns the ORDER BY clause for the sort, always tie-breaking on id so that
+// rows sharing a sort value are returned in a stable order. When paging backwards from
+// a cursor the ordering is reversed, and the results must be flipped back afterwards.
+func (f Filters) orderBy(backwards bool) string {
+	direction := f.sortDirection()
+	idDirection := "ASC"
+
+	if backwards {
+		direction = reverseDirection(direction)
+		idDirection = "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, id %s", f.sortColumn(), direction, idDirection)
+}
+
+// keysetCondition returns a WHERE condition selecting the rows that come after
+// (or before, if backwards) the sort column value and id bound to the given placeholders
+func (f Filters) keysetCondition(backwards bool, valuePlaceholder, idPlaceholder string) string {
+	columnOperator, idOperator := ">", ">"
+
+	if f.sortDirection() == "DESC" {
+		columnOperator = "<"
+	}
+
+	if backwards {
+		columnOperator = reverseOperator(columnOperator)
+		idOperator = reverseOperator(idOperator)
+	}
+
+	return fmt.Sprintf(
+		"(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id %[4]s %[5]s))",
+		f.sortColumn(), columnOperator, valuePlaceholder, idOperator, idPlaceholder,
+	)
+}
+
+func reverseDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func reverseOperator(operator string) string {
+	if operator == ">" {
+		return "<"
+	}
+	return ">"
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -50,11 +103,13 @@ func (f Filters) offset() int {
 }
 
 type PageInfo struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func calculatePageInfo(totalRecords, page, pageSize int) PageInfo {
@@ -70,3 +125,12 @@ func calculatePageInfo(totalRecords, page, pageSize int) PageInfo {
 		TotalRecords: totalRecords,
 	}
 }
+
+// queryArgs collects the arguments of a query as its conditions are built up,
+// handing back the placeholder to use for each one
+type queryArgs []any
+
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
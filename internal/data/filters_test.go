@@ -0,0 +1,59 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSortSafeList = []string{"id", "title", "year", "-id", "-title", "-year"}
+
+// Paging backwards reverses the ordering (including the id tie-break) to fetch the
+// rows just before the cursor, which GetAll then flips back into the requested order
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		sort      string
+		backwards bool
+		want      string
+	}{
+		{"title", false, "title ASC, id ASC"},
+		{"-title", false, "title DESC, id ASC"},
+		{"title", true, "title DESC, id DESC"},
+		{"-title", true, "title ASC, id DESC"},
+	}
+
+	for _, tt := range tests {
+		filters := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}
+
+		assert.Equal(t, tt.want, filters.orderBy(tt.backwards), "sort %q backwards %t", tt.sort, tt.backwards)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		sort      string
+		backwards bool
+		want      string
+	}{
+		{"year", false, "(year > $1 OR (year = $1 AND id > $2))"},
+		{"-year", false, "(year < $1 OR (year = $1 AND id > $2))"},
+		{"year", true, "(year < $1 OR (year = $1 AND id < $2))"},
+		{"-year", true, "(year > $1 OR (year = $1 AND id < $2))"},
+	}
+
+	for _, tt := range tests {
+		filters := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}
+
+		assert.Equal(t, tt.want, filters.keysetCondition(tt.backwards, "$1", "$2"), "sort %q backwards %t", tt.sort, tt.backwards)
+	}
+}
+
+func TestReverseDirection(t *testing.T) {
+	assert.Equal(t, "DESC", reverseDirection("ASC"))
+	assert.Equal(t, "ASC", reverseDirection("DESC"))
+}
+
+func TestReverseOperator(t *testing.T) {
+	assert.Equal(t, "<", reverseOperator(">"))
+	assert.Equal(t, ">", reverseOperator("<"))
+}
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+var genreSlugRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+type Genre struct {
+	Slug       string   `json:"slug"`
+	Name       string   `json:"name"`
+	Aliases    []string `json:"aliases"`
+	MovieCount int      `json:"movieCount"`
+}
+
+// GenreSlug reduces a genre to the form genres and their aliases are stored in,
+// so "Sci-Fi", "sci fi" and "SCI_FI" are all matched by the sci-fi alias
+func GenreSlug(genre string) string {
+	return strings.Trim(genreSlugRX.ReplaceAllString(strings.ToLower(genre), "-"), "-")
+}
+
+// GenreTaxonomy maps every canonical slug and alias to the slug of the genre it stands for
+type GenreTaxonomy map[string]string
+
+// Normalize replaces each genre with its canonical slug, dropping any duplicates that creates.
+// Genres that aren't recognised are returned along with the closest matching slugs.
+func (t GenreTaxonomy) Normalize(genres []string) ([]string, map[string][]string) {
+	normalized := make([]string, 0, len(genres))
+	unknown := make(map[string][]string)
+
+	for _, genre := range genres {
+		slug, ok := t[GenreSlug(genre)]
+		if !ok {
+			unknown[genre] = t.suggest(GenreSlug(genre))
+			continue
+		}
+
+		if !validator.PermittedValue(slug, normalized...) {
+			normalized = append(normalized, slug)
+		}
+	}
+
+	return normalized, unknown
+}
+
+// suggest returns up to three canonical slugs that the unknown slug might be a misspelling,
+// abbreviation or variation of
+func (t GenreTaxonomy) suggest(slug string) []string {
+	if slug == "" {
+		return nil
+	}
+
+	type candidate struct {
+		slug     string
+		distance int
+	}
+
+	best := make(map[string]int)
+
+	for name, canonical := range t {
+		distance := levenshtein(slug, name)
+
+		// Prefixes such as "doc" and "docu" are treated as close matches regardless of length
+		if strings.HasPrefix(name, slug) || strings.HasPrefix(slug, name) {
+			distance = 1
+		}
+
+		if distance > len(name)/3+1 {
+			continue
+		}
+
+		if current, ok := best[canonical]; !ok || distance < current {
+			best[canonical] = distance
+		}
+	}
+
+	candidates := make([]candidate, 0, len(best))
+	for canonical, distance := range best {
+		candidates = append(candidates, candidate{canonical, distance})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].slug < candidates[j].slug
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < 3; i++ {
+		suggestions = append(suggestions, candidates[i].slug)
+	}
+
+	return suggestions
+}
+
+// UnknownGenresMessage describes the unknown genres returned by Normalize, in the order they were given
+func UnknownGenresMessage(genres []string, unknown map[string][]string) string {
+	messages := []string{}
+	described := make(map[string]bool)
+
+	for _, genre := range genres {
+		suggestions, ok := unknown[genre]
+		if !ok || described[genre] {
+			continue
+		}
+		described[genre] = true
+
+		message := fmt.Sprintf("%q is not a known genre", genre)
+
+		if len(suggestions) > 0 {
+			quoted := make([]string, len(suggestions))
+			for i, suggestion := range suggestions {
+				quoted[i] = strconv.Quote(suggestion)
+			}
+
+			message += ", did you mean " + strings.Join(quoted, " or ") + "?"
+		}
+
+		messages = append(messages, message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+	return smallest
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+func (m GenreModel) Taxonomy() (GenreTaxonomy, error) {
+	query := `
+        SELECT slug, slug FROM genres
+        UNION ALL
+        SELECT alias, slug FROM genre_aliases
+        INNER JOIN genres ON genres.id = genre_aliases.genre_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxonomy := GenreTaxonomy{}
+
+	for rows.Next() {
+		var name, slug string
+
+		err := rows.Scan(&name, &slug)
+		if err != nil {
+			return nil, err
+		}
+
+		taxonomy[name] = slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return taxonomy, nil
+}
+
+// GetAll returns every genre along with the number of movies in it, not counting those in the trash
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+        SELECT genres.slug, genres.name,
+            ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id ORDER BY alias),
+            (SELECT COUNT(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL)
+        FROM genres
+        ORDER BY genres.slug
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
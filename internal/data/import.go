@@ -0,0 +1,135 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Import loads the movies with COPY for throughput, all within a single transaction. When upsert
+// is set, movies matching an existing one's title and year update it rather than being inserted.
+func (m MovieModel) Import(movies []*Movie, upsert bool) (inserted int64, updated int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Movies are copied into a staging table first, as COPY can only ever insert
+	query := `
+        CREATE TEMPORARY TABLE movies_import (
+            title text NOT NULL,
+            year integer NOT NULL,
+            runtime integer NOT NULL,
+            genres text[] NOT NULL
+        ) ON COMMIT DROP
+	`
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("movies_import", "title", "year", "runtime", "genres"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, movie := range movies {
+		_, err = stmt.ExecContext(ctx, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+		if err != nil {
+			stmt.Close()
+			return 0, 0, err
+		}
+	}
+
+	// Executing the statement with no arguments flushes the buffered rows
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return 0, 0, err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if upsert {
+		// Joining movies to itself gives each row as it was before the update, so the
+		// revisions and webhook events can be recorded by the same statement
+		query = `
+            WITH updated AS (
+                UPDATE movies
+                SET runtime = movies_import.runtime, genres = movies_import.genres, version = movies.version + 1
+                FROM movies_import, movies AS old
+                WHERE movies.title = movies_import.title AND movies.year = movies_import.year
+                AND movies.deleted_at IS NULL AND old.id = movies.id
+                RETURNING movies.id, movies.version, to_jsonb(old.*) - 'search_vector' AS before,
+                    to_jsonb(movies.*) - 'search_vector' AS after
+            ), revisions AS (
+                INSERT INTO movie_revisions (movie_id, version, action, before, after)
+                SELECT id, version, 'update', before, after
+                FROM updated
+            )
+            INSERT INTO webhook_events (type, data)
+            SELECT 'movie.updated', jsonb_build_object('id', id, 'version', version)
+            FROM updated
+		`
+
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		updated, err = result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	query = `
+        WITH inserted AS (
+            INSERT INTO movies (title, year, runtime, genres)
+            SELECT title, year, runtime, genres
+            FROM movies_import
+            %s
+            RETURNING movies.*
+        ), revisions AS (
+            INSERT INTO movie_revisions (movie_id, version, action, after)
+            SELECT id, version, 'insert', to_jsonb(inserted.*) - 'search_vector'
+            FROM inserted
+        )
+        INSERT INTO webhook_events (type, data)
+        SELECT 'movie.created', jsonb_build_object('id', id, 'version', version)
+        FROM inserted
+	`
+
+	notExisting := ""
+	if upsert {
+		notExisting = `WHERE NOT EXISTS (
+                SELECT 1 FROM movies
+                WHERE movies.title = movies_import.title AND movies.year = movies_import.year
+                AND movies.deleted_at IS NULL
+            )`
+	}
+
+	query = fmt.Sprintf(query, notExisting)
+
+	result, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	inserted, err = result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return inserted, updated, tx.Commit()
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	JobStatusPending = "pending"
+	// Dead jobs have used up all of their attempts. They're kept so they can be looked
+	// into, but are never run again.
+	JobStatusDead = "dead"
+)
+
+// Job is a unit of background work. Its payload is decoded by the handler for its kind.
+type Job struct {
+	ID          int64
+	CreatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	Error       string
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Enqueue adds a job to be run as soon as a worker for its kind is free
+func (m JobModel) Enqueue(kind string, payload any, maxAttempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return enqueueJob(ctx, m.DB, kind, payload, maxAttempts)
+}
+
+// EnqueueTx adds the job in the transaction, so it's only ever run if the changes it follows
+// up on are committed
+func (m JobModel) EnqueueTx(ctx context.Context, tx *sql.Tx, kind string, payload any, maxAttempts int) error {
+	return enqueueJob(ctx, tx, kind, payload, maxAttempts)
+}
+
+func enqueueJob(ctx context.Context, db querier, kind string, payload any, maxAttempts int) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO jobs (kind, payload, max_attempts)
+        VALUES ($1, $2, $3)
+	`
+
+	_, err = db.ExecContext(ctx, query, kind, string(js), maxAttempts)
+	return err
+}
+
+// Claim takes the next job of the kind that's due to run, returning ErrRecordNotFound if there
+// aren't any. Locked jobs are skipped, so any number of workers can claim jobs at the same time.
+// The job is pushed back by the lease, so if it's never completed or failed, say because the
+// API crashed, it's run again once the lease runs out.
+func (m JobModel) Claim(kind string, lease time.Duration) (*Job, error) {
+	query := `
+        WITH due AS (
+            SELECT id
+            FROM jobs
+            WHERE kind = $1 AND status = 'pending' AND run_at <= $2
+            ORDER BY run_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        UPDATE jobs
+        SET attempts = attempts + 1, run_at = $3
+        FROM due
+        WHERE jobs.id = due.id
+        RETURNING jobs.id, jobs.created_at, jobs.kind, jobs.payload, jobs.status, jobs.attempts, jobs.max_attempts, jobs.error
+	`
+
+	var job Job
+
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, kind, now, now.Add(lease)).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.Error,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Complete removes a job that ran successfully
+func (m JobModel) Complete(job *Job) error {
+	query := `
+        DELETE FROM jobs
+        WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, job.ID)
+	return err
+}
+
+// Fail records the error from running the job. The job is run again at retryAt, unless it has
+// used up all of its attempts, in which case it's marked as dead.
+func (m JobModel) Fail(job *Job, jobErr error, retryAt time.Time) error {
+	query := `
+        UPDATE jobs
+        SET status = $1, error = $2, run_at = $3
+        WHERE id = $4
+	`
+
+	job.Status = JobStatusPending
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = JobStatusDead
+	}
+
+	job.Error = jobErr.Error()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, job.Status, job.Error, retryAt, job.ID)
+	return err
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -11,15 +13,66 @@ var (
 )
 
 type Models struct {
-	Movies MovieModel
-	Tokens TokenModel
-	Users  UserModel
+	Audit        AuditModel
+	Credits      CreditModel
+	Genres       GenreModel
+	Jobs         JobModel
+	Movies       MovieModel
+	People       PersonModel
+	Permissions  PermissionModel
+	Reviews      ReviewModel
+	Tokens       TokenModel
+	Translations TranslationModel
+	Users        UserModel
+	Watchlists   WatchlistModel
+	Webhooks     WebhookModel
+
+	db *sql.DB
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, cursorSecret []byte) Models {
 	return Models{
-		Movies: MovieModel{DB: db},
-		Tokens: TokenModel{DB: db},
-		Users:  UserModel{DB: db},
+		Audit:        AuditModel{DB: db},
+		Credits:      CreditModel{DB: db},
+		Genres:       GenreModel{DB: db},
+		Jobs:         JobModel{DB: db},
+		Movies:       MovieModel{DB: db, cursorSecret: cursorSecret},
+		People:       PersonModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		Reviews:      ReviewModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Translations: TranslationModel{DB: db},
+		Users:        UserModel{DB: db},
+		Watchlists:   WatchlistModel{DB: db},
+		Webhooks:     WebhookModel{DB: db},
+		db:           db,
+	}
+}
+
+// Transaction runs fn in a transaction, which is committed if fn returns nil and rolled back
+// otherwise. The models' Tx methods take the transaction, so changes made with several of them
+// are committed together. The transaction is also rolled back if ctx is cancelled.
+func (m Models) Transaction(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so queries can be run inside or outside a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -15,10 +17,22 @@ type Movie struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
 	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	// Locale and OriginalTitle are only set when the title has been replaced with a translation
+	Locale        string     `json:"locale,omitempty"`
+	OriginalTitle string     `json:"originalTitle,omitempty"`
+	Year          int32      `json:"year,omitempty"`
+	Runtime       Runtime    `json:"runtime,omitempty"`
+	Genres        []string   `json:"genres,omitempty"`
+	Version       int32      `json:"version"`
+	DeletedAt     *time.Time `json:"deletedAt,omitempty"`
+	Poster        Poster     `json:"poster,omitempty"`
+	// Rating is the average rating of the movie's reviews, or zero if it hasn't been reviewed
+	Rating      float64 `json:"rating"`
+	ReviewCount int32   `json:"reviewCount"`
+	// OnWatchlist is only set when the movie is fetched for an authenticated user
+	OnWatchlist *bool `json:"onWatchlist,omitempty"`
+	// Credits are only loaded when asked for with include=credits
+	Credits []*Credit `json:"credits,omitempty"`
 }
 
 func (m Movie) Validate(v *validator.Validator) {
@@ -38,11 +52,309 @@ func (m Movie) Validate(v *validator.Validator) {
 	v.Check(validator.Unique(m.Genres), "genres", "must not contain duplicate values")
 }
 
+// MovieFieldSafeList holds the fields clients can choose between with a sparse fieldset
+var MovieFieldSafeList = []string{"id", "title", "year", "runtime", "genres", "version", "rating", "reviewCount", "poster"}
+
+// MovieFieldOnWatchlist can also be chosen in a sparse fieldset, but isn't stored with the movie,
+// as it depends on who's asking
+const MovieFieldOnWatchlist = "onWatchlist"
+
+var movieColumns = []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "rating", "review_count", "poster"}
+
+// fieldColumn returns the column holding a field, where their names differ
+func fieldColumn(field string) string {
+	switch field {
+	case "reviewCount":
+		return "review_count"
+	default:
+		return field
+	}
+}
+
+func ValidateMovieFields(v *validator.Validator, fields []string) {
+	for _, field := range fields {
+		if field != MovieFieldOnWatchlist && !validator.PermittedValue(field, MovieFieldSafeList...) {
+			v.AddError("fields", fmt.Sprintf("unknown field %q", field))
+		}
+	}
+
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
+}
+
+// selectColumns returns the columns needed for a sparse fieldset, along with any required
+// for the query itself, or every column if no fields were requested
+func selectColumns(fields []string, required ...string) []string {
+	if len(fields) == 0 {
+		return movieColumns
+	}
+
+	columns := append([]string{}, required...)
+
+	for _, field := range fields {
+		if field == MovieFieldOnWatchlist {
+			continue
+		}
+
+		if column := fieldColumn(field); !validator.PermittedValue(column, columns...) {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// columnDestination returns where the value of a column should be scanned to
+func (m *Movie) columnDestination(column string) any {
+	switch column {
+	case "id":
+		return &m.ID
+	case "created_at":
+		return &m.CreatedAt
+	case "title":
+		return &m.Title
+	case "year":
+		return &m.Year
+	case "runtime":
+		return &m.Runtime
+	case "genres":
+		return pq.Array(&m.Genres)
+	case "version":
+		return &m.Version
+	case "deleted_at":
+		return &m.DeletedAt
+	case "rating":
+		return &m.Rating
+	case "review_count":
+		return &m.ReviewCount
+	case "poster":
+		return &m.Poster
+	default:
+		panic("unknown movie column: " + column)
+	}
+}
+
+// SelectFields returns only the requested fields of the movie, ready to be serialized
+func (m *Movie) SelectFields(fields []string) map[string]any {
+	selected := make(map[string]any, len(fields))
+
+	for _, field := range fields {
+		switch field {
+		case "id":
+			selected[field] = m.ID
+		case "title":
+			selected[field] = m.Title
+
+			if m.Locale != "" {
+				selected["locale"] = m.Locale
+				selected["originalTitle"] = m.OriginalTitle
+			}
+		case "year":
+			selected[field] = m.Year
+		case "runtime":
+			selected[field] = &m.Runtime
+		case "genres":
+			selected[field] = m.Genres
+		case "version":
+			selected[field] = m.Version
+		case "rating":
+			selected[field] = m.Rating
+		case "reviewCount":
+			selected[field] = m.ReviewCount
+		case "poster":
+			selected[field] = m.Poster
+		case MovieFieldOnWatchlist:
+			if m.OnWatchlist != nil {
+				selected[field] = *m.OnWatchlist
+			}
+		}
+	}
+
+	if m.Credits != nil {
+		selected["credits"] = m.Credits
+	}
+
+	return selected
+}
+
+const (
+	GenresModeAll  = "all"
+	GenresModeAny  = "any"
+	GenresModeNone = "none"
+)
+
+// MovieQuery holds the criteria used to filter the list of movies. Zero values mean
+// that criterion isn't applied.
+type MovieQuery struct {
+	Title         string
+	Genres        []string
+	GenresMode    string
+	YearMin       int32
+	YearMax       int32
+	RuntimeMin    Runtime
+	RuntimeMax    Runtime
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	PersonID      int64
+
+	// Fuzzy matches titles by trigram similarity instead of full-text search
+	Fuzzy               bool
+	SimilarityThreshold float64
+
+	// Fields limits the columns selected, every column is selected if it's empty
+	Fields []string
+}
+
+func (q MovieQuery) Validate(v *validator.Validator) {
+	v.Check(!q.Fuzzy || q.Title != "", "title", "must be provided for a fuzzy search")
+
+	v.Check(
+		validator.PermittedValue(q.GenresMode, GenresModeAll, GenresModeAny, GenresModeNone),
+		"genres_mode",
+		"must be one of all, any or none",
+	)
+
+	v.Check(q.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(q.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(q.YearMax == 0 || q.YearMin <= q.YearMax, "year_min", "must not be greater than year_max")
+
+	v.Check(q.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(q.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(q.RuntimeMax == 0 || q.RuntimeMin <= q.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+
+	v.Check(
+		q.CreatedAfter.IsZero() || q.CreatedBefore.IsZero() || q.CreatedAfter.Before(q.CreatedBefore),
+		"created_after",
+		"must be before created_before",
+	)
+
+	v.Check(q.PersonID >= 0, "person_id", "must not be negative")
+}
+
+// conditions translates the query into WHERE conditions, adding any user input to args
+// so it's only ever passed to Postgres as a parameter
+func (q MovieQuery) conditions(args *queryArgs) []string {
+	conditions := []string{"deleted_at IS NULL"}
+
+	// Titles match if either the original title or any of its translations do
+	if q.Fuzzy {
+		// % matches titles whose trigram similarity is above pg_trgm.similarity_threshold
+		conditions = append(conditions, fmt.Sprintf(
+			`(title %% %[1]s OR EXISTS (
+			SELECT 1 FROM movie_translations WHERE movie_id = movies.id AND movie_translations.title %% %[1]s
+		))`, args.add(q.Title),
+		))
+	} else {
+		conditions = append(conditions, fmt.Sprintf(
+			`(to_tsvector('simple', title) @@ plainto_tsquery('simple', %[1]s) OR %[1]s = '' OR EXISTS (
+			SELECT 1 FROM movie_translations
+			WHERE movie_id = movies.id AND to_tsvector('simple', movie_translations.title) @@ plainto_tsquery('simple', %[1]s)
+		))`, args.add(q.Title),
+		))
+	}
+
+	if len(q.Genres) > 0 {
+		genres := args.add(pq.Array(q.Genres))
+
+		switch q.GenresMode {
+		case GenresModeAny:
+			conditions = append(conditions, fmt.Sprintf("genres && %s", genres))
+		case GenresModeNone:
+			conditions = append(conditions, fmt.Sprintf("NOT genres && %s", genres))
+		default:
+			conditions = append(conditions, fmt.Sprintf("genres @> %s", genres))
+		}
+	}
+
+	if q.YearMin != 0 {
+		conditions = append(conditions, fmt.Sprintf("year >= %s", args.add(q.YearMin)))
+	}
+
+	if q.YearMax != 0 {
+		conditions = append(conditions, fmt.Sprintf("year <= %s", args.add(q.YearMax)))
+	}
+
+	if q.RuntimeMin != 0 {
+		conditions = append(conditions, fmt.Sprintf("runtime >= %s", args.add(q.RuntimeMin)))
+	}
+
+	if q.RuntimeMax != 0 {
+		conditions = append(conditions, fmt.Sprintf("runtime <= %s", args.add(q.RuntimeMax)))
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at > %s", args.add(q.CreatedAfter)))
+	}
+
+	if !q.CreatedBefore.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at < %s", args.add(q.CreatedBefore)))
+	}
+
+	if q.PersonID != 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM credits WHERE credits.movie_id = movies.id AND credits.person_id = %s)", args.add(q.PersonID),
+		))
+	}
+
+	return conditions
+}
+
+// orderBy returns the ORDER BY clause for the query, putting the closest matches first for fuzzy searches
+func (q MovieQuery) orderBy(args *queryArgs, filters Filters, backwards bool) string {
+	orderBy := filters.orderBy(backwards)
+
+	if q.Fuzzy {
+		// GREATEST ignores the NULL from the subquery when the movie has no translations
+		orderBy = fmt.Sprintf(
+			"GREATEST(similarity(title, %[1]s), (SELECT MAX(similarity(movie_translations.title, %[1]s)) FROM movie_translations WHERE movie_id = movies.id)) DESC, %[2]s",
+			args.add(q.Title),
+			orderBy,
+		)
+	}
+
+	return orderBy
+}
+
+// sortValue returns the value of the column the movie is being sorted by, as a string
+// that Postgres can compare against that column when paging with a cursor
+func (m Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return m.Title
+	case "year":
+		return strconv.Itoa(int(m.Year))
+	case "runtime":
+		return strconv.Itoa(int(m.Runtime))
+	case "rating":
+		return strconv.FormatFloat(m.Rating, 'f', 2, 64)
+	default:
+		return strconv.FormatInt(m.ID, 10)
+	}
+}
+
 type MovieModel struct {
-	DB *sql.DB
+	DB           *sql.DB
+	cursorSecret []byte
+}
+
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertMovie(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+func insertMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
@@ -51,35 +363,67 @@ func (m MovieModel) Insert(movie *Movie) error {
 
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	return m.DB.QueryRow(query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	return recordRevision(ctx, tx, movie.ID, RevisionActionInsert, nil, userID)
+}
+
+// InsertMany inserts all of the movies in a single transaction, so either all of them are created or none are
+func (m MovieModel) InsertMany(movies []*Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, movie := range movies {
+		err := insertMovie(ctx, tx, movie, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	return m.GetWithFields(id, nil)
+}
+
+// GetWithFields only selects the columns for the given fields, selecting every column if there are none
+func (m MovieModel) GetWithFields(id int64, fields []string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-        SELECT id, created_at, title, year, runtime, genres, version
+	// The version, rating and review count are always needed to generate the movie's ETag
+	columns := selectColumns(fields, "id", "version", "rating", "review_count")
+
+	query := fmt.Sprintf(`
+        SELECT %s
         FROM movies
-        WHERE id = $1
-	`
+        WHERE id = $1 AND deleted_at IS NULL`,
+		strings.Join(columns, ", "),
+	)
 
 	var movie Movie
 
+	destinations := make([]any, len(columns))
+	for i, column := range columns {
+		destinations[i] = movie.columnDestination(column)
+	}
+
 	// The timout countdown begins the moment this ctx is created
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(destinations...)
 
 	if err != nil {
 		switch {
@@ -93,24 +437,67 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, PageInfo, error) {
+func (m MovieModel) GetAll(movieQuery MovieQuery, filters Filters) ([]*Movie, PageInfo, error) {
+	args := queryArgs{}
+
+	conditions := movieQuery.conditions(&args)
+
+	var position *cursor
+
+	if filters.Cursor != "" {
+		c, err := filters.cursorPosition(m.cursorSecret)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		position = &c
+		conditions = append(conditions, filters.keysetCondition(c.Backwards, args.add(c.Value), args.add(c.ID)))
+	}
+
+	backwards := position != nil && position.Backwards
+
+	// Counting every matching row defeats the point of keyset pagination, so it's skipped when using a cursor
+	totalRecordsColumn := "COUNT(*) OVER()"
+	if position != nil {
+		totalRecordsColumn = "0"
+	}
+
+	orderBy := movieQuery.orderBy(&args, filters, backwards)
+
+	// The sort column is always needed to build cursors from the results
+	columns := selectColumns(movieQuery.Fields, "id", filters.sortColumn())
+
+	// One extra row is fetched to find out whether there is another page after this one
 	query := fmt.Sprintf(`
-        SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version
+        SELECT %s, %s
         FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
-        ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`,
-		filters.sortColumn(),
-		filters.sortDirection(),
+		WHERE %s
+        ORDER BY %s
+		LIMIT %s OFFSET %s`,
+		totalRecordsColumn,
+		strings.Join(columns, ", "),
+		strings.Join(conditions, "\n\t\tAND "),
+		orderBy,
+		args.add(filters.limit()+1),
+		args.add(filters.offset()),
 	)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	var db querier = m.DB
+
+	if movieQuery.Fuzzy {
+		tx, err := m.beginFuzzyTx(ctx, movieQuery.SimilarityThreshold)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		defer tx.Rollback()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+		db = tx
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, PageInfo{}, err
 	}
@@ -122,16 +509,12 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	for rows.Next() {
 		var movie Movie
 
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		destinations := []any{&totalRecords}
+		for _, column := range columns {
+			destinations = append(destinations, movie.columnDestination(column))
+		}
+
+		err := rows.Scan(destinations...)
 		if err != nil {
 			return nil, PageInfo{}, err
 		}
@@ -143,16 +526,60 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		return nil, PageInfo{}, err
 	}
 
-	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	if backwards {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	var pageInfo PageInfo
+	if position == nil {
+		pageInfo = calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+	} else {
+		pageInfo = PageInfo{PageSize: filters.PageSize}
+	}
+
+	// Fuzzy results are ordered by similarity rather than the sort column, so a cursor
+	// built from them couldn't be used to fetch the next page
+	if len(movies) > 0 && !movieQuery.Fuzzy {
+		first, last := movies[0], movies[len(movies)-1]
+
+		hasNext := hasMore || backwards
+		hasPrev := (backwards && hasMore) || (!backwards && (position != nil || filters.Page > 1))
+
+		if hasNext {
+			pageInfo.NextCursor = m.cursorAt(filters, last, false)
+		}
+
+		if hasPrev {
+			pageInfo.PrevCursor = m.cursorAt(filters, first, true)
+		}
+	}
 
 	return movies, pageInfo, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+func (m MovieModel) cursorAt(filters Filters, movie *Movie, backwards bool) string {
+	c := cursor{
+		Sort:      filters.Sort,
+		Value:     movie.sortValue(filters.sortColumn()),
+		ID:        movie.ID,
+		Backwards: backwards,
+	}
+
+	return encodeCursor(m.cursorSecret, c)
+}
+
+func (m MovieModel) Update(movie *Movie, userID int64) error {
 	query := `
         UPDATE movies
         SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        WHERE id = $5 AND version = $6 AND deleted_at IS NULL
         RETURNING version
 	`
 
@@ -168,31 +595,158 @@ func (m MovieModel) Update(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version); err != nil {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, movie.ID, false)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			fmt.Printf("correct db err %s", err.Error())
 			return ErrEditConflict
 		default:
-			fmt.Printf("db err %s", err.Error())
 			return err
 		}
 	}
 
-	return nil
+	err = recordRevision(ctx, tx, movie.ID, RevisionActionUpdate, &before, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Delete(id int64) error {
+// SetPoster replaces the movie's poster, going through the same version check as Update
+func (m MovieModel) SetPoster(movie *Movie, poster Poster, userID int64) error {
+	query := `
+        UPDATE movies
+        SET poster = $1, version = version + 1
+        WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+        RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, movie.ID, false)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, poster, movie.ID, movie.Version).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = recordRevision(ctx, tx, movie.ID, RevisionActionUpdate, &before, userID)
+	if err != nil {
+		return err
+	}
+
+	movie.Poster = poster
+
+	return tx.Commit()
+}
+
+func (m MovieModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Movies are only moved to the trash, from where they can be restored until they're purged
+	query := `
+        UPDATE movies
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, id, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(ctx, tx, id, RevisionActionDelete, &before, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVersion only deletes the movie if it's still at the given version, returning ErrEditConflict if it's been changed
+func (m MovieModel) DeleteVersion(id int64, version int32, userID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := "DELETE FROM movies WHERE id = $1"
+	query := `
+        UPDATE movies
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, id, false)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -203,8 +757,170 @@ func (m MovieModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return ErrEditConflict
+	}
+
+	err = recordRevision(ctx, tx, id, RevisionActionDelete, &before, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllDeleted lists the movies in the trash, most recently deleted first
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at, rating, review_count, poster
+        FROM movies
+        WHERE deleted_at IS NOT NULL
+        ORDER BY deleted_at DESC, id ASC
+        LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt,
+			&movie.Rating,
+			&movie.ReviewCount,
+			&movie.Poster,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, pageInfo, nil
+}
+
+// Restore takes a movie back out of the trash, returning ErrRecordNotFound if it isn't in there
+func (m MovieModel) Restore(id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        UPDATE movies
+        SET deleted_at = NULL, version = version + 1
+        WHERE id = $1 AND deleted_at IS NOT NULL
+        RETURNING id, created_at, title, year, runtime, genres, version, rating, review_count, poster
+	`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Rating,
+		&movie.ReviewCount,
+		&movie.Poster,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = recordRevision(ctx, tx, id, RevisionActionRestore, &before, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, tx.Commit()
+}
+
+// PurgeDeleted permanently deletes movies that have been in the trash for longer than the retention
+// period. It returns the number of movies deleted and the posters they had, whose blobs are left for
+// the caller to delete.
+func (m MovieModel) PurgeDeleted(retention time.Duration) (int64, []Poster, error) {
+	query := `
+        DELETE FROM movies
+        WHERE deleted_at < $1
+        RETURNING poster
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var purged int64
+	posters := []Poster{}
+
+	for rows.Next() {
+		var poster Poster
+
+		err := rows.Scan(&poster)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		purged++
+
+		if poster != "" {
+			posters = append(posters, poster)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
 	}
 
-	return nil
+	return purged, posters, nil
 }
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Movies and people can be read by anyone, changing them or their credits, translations
+	// and posters needs movies:write
+	PermissionMoviesWrite  = "movies:write"
+	PermissionMoviesExport = "movies:export"
+	// Webhooks can subscribe to events about users, so managing them is restricted
+	PermissionWebhooksManage = "webhooks:manage"
+	PermissionUsersManage    = "users:manage"
+)
+
+// PermissionCodes holds every permission that can be given to a user
+var PermissionCodes = []string{
+	PermissionMoviesWrite, PermissionMoviesExport, PermissionWebhooksManage, PermissionUsersManage,
+}
+
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getPermissionsForUser(ctx, m.DB, userID)
+}
+
+// GetAllForUserTx gets the user's permissions in the transaction. The user is locked until the
+// transaction ends, so transactions changing the same user's permissions take turns.
+func (m PermissionModel) GetAllForUserTx(ctx context.Context, tx *sql.Tx, userID int64) (Permissions, error) {
+	// Unlike FOR UPDATE, this doesn't hold up inserting rows that reference the user, such as their reviews
+	_, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return getPermissionsForUser(ctx, tx, userID)
+}
+
+func getPermissionsForUser(ctx context.Context, db querier, userID int64) (Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+        WHERE users_permissions.user_id = $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+        INSERT INTO users_permissions
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+        ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// SetForUser replaces the user's permissions with the given ones
+func (m PermissionModel) SetForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.SetForUserTx(ctx, tx, userID, codes...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetForUserTx replaces the user's permissions with the given ones in the transaction
+func (m PermissionModel) SetForUserTx(ctx context.Context, tx *sql.Tx, userID int64, codes ...string) error {
+	query := `
+        DELETE FROM users_permissions
+        WHERE user_id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+        INSERT INTO users_permissions
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
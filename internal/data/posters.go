@@ -0,0 +1,51 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PosterURLPrefix is the path posters are served from
+const PosterURLPrefix = "/v1/posters/"
+
+// Poster is the file name of a movie's poster, or empty if it doesn't have one.
+// Each poster has a JPEG thumbnail stored alongside it.
+type Poster string
+
+func (p Poster) Key() string {
+	return PosterKey(string(p))
+}
+
+func (p Poster) ThumbnailName() string {
+	name := string(p)
+	if i := strings.LastIndexByte(name, '.'); i != -1 {
+		name = name[:i]
+	}
+
+	return name + "-thumb.jpg"
+}
+
+func (p Poster) ThumbnailKey() string {
+	return PosterKey(p.ThumbnailName())
+}
+
+func (p Poster) URL() string {
+	return PosterURLPrefix + string(p)
+}
+
+func (p Poster) ThumbnailURL() string {
+	return PosterURLPrefix + p.ThumbnailName()
+}
+
+func (p Poster) MarshalJSON() ([]byte, error) {
+	if p == "" {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(map[string]string{"url": p.URL(), "thumbnailUrl": p.ThumbnailURL()})
+}
+
+// PosterKey returns the blob storage key for a poster, or its thumbnail, with the given file name
+func PosterKey(name string) string {
+	return "posters/" + name
+}
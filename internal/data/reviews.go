@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	MovieID   int64     `json:"movieId"`
+	UserID    int64     `json:"userId"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body"`
+	Version   int32     `json:"version"`
+}
+
+func (r Review) Validate(v *validator.Validator) {
+	v.Check(r.Rating != 0, "rating", "must be provided")
+	v.Check(r.Rating >= 1 && r.Rating <= 10, "rating", "must be between 1 and 10")
+
+	v.Check(r.Body != "", "body", "must be provided")
+	v.Check(len(r.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the review and updates the movie's aggregate rating in the same transaction.
+// ErrRecordNotFound is returned if the movie doesn't exist, and ErrDuplicateReview if the
+// user has already reviewed it.
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+        INSERT INTO reviews (movie_id, user_id, rating, body)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version
+	`
+
+	args := []any{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockMovieForReview(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = updateMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) Get(movieID, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT reviews.id, reviews.created_at, movie_id, user_id, reviews.rating, body, reviews.version
+        FROM reviews
+        INNER JOIN movies ON movies.id = reviews.movie_id
+        WHERE reviews.id = $1 AND movie_id = $2 AND movies.deleted_at IS NULL
+	`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, movieID).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.MovieID,
+		&review.UserID,
+		&review.Rating,
+		&review.Body,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (m ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), id, created_at, movie_id, user_id, rating, body, version
+        FROM reviews
+        WHERE movie_id = $1
+        ORDER BY ` + filters.orderBy(false) + `
+        LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, pageInfo, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+        UPDATE reviews
+        SET rating = $1, body = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version
+	`
+
+	args := []any{review.Rating, review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockMovieForReview(ctx, tx, review.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = updateMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete only deletes the review if it's still at the given version, returning ErrEditConflict if it's been changed
+func (m ReviewModel) Delete(review *Review) error {
+	query := `
+        DELETE FROM reviews
+        WHERE id = $1 AND version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockMovieForReview(ctx, tx, review.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query, review.ID, review.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	err = updateMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockMovieForReview locks the movie's row until the transaction ends. Changes to a movie's
+// reviews are serialized this way so that the aggregate rating is always calculated from
+// every committed review, rather than from whatever each transaction could see when it began.
+func lockMovieForReview(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	query := `
+        SELECT id
+        FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR UPDATE
+	`
+
+	var id int64
+
+	err := tx.QueryRowContext(ctx, query, movieID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateMovieRating recalculates the movie's average rating and review count. The movie's
+// version isn't incremented, as its reviews aren't edits to the movie itself.
+func updateMovieRating(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	query := `
+        UPDATE movies
+        SET rating = stats.rating, review_count = stats.review_count
+        FROM (
+            SELECT COALESCE(ROUND(AVG(rating), 2), 0) AS rating, COUNT(*) AS review_count
+            FROM reviews
+            WHERE movie_id = $1
+        ) AS stats
+        WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, movieID)
+	return err
+}
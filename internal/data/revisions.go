@@ -0,0 +1,197 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	RevisionActionInsert  = "insert"
+	RevisionActionUpdate  = "update"
+	RevisionActionDelete  = "delete"
+	RevisionActionRestore = "restore"
+)
+
+// MovieRevision records a change made to a movie. Before and After hold snapshots of the
+// full row, with Before being null for inserts.
+type MovieRevision struct {
+	ID        int64           `json:"id"`
+	MovieID   int64           `json:"movieId"`
+	Version   int32           `json:"version"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	UserID    *int64          `json:"userId"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Snapshot returns the movie as it was after the change was made
+func (r MovieRevision) Snapshot() (*Movie, error) {
+	var snapshot struct {
+		ID        int64      `json:"id"`
+		CreatedAt time.Time  `json:"created_at"`
+		Title     string     `json:"title"`
+		Year      int32      `json:"year"`
+		Runtime   int32      `json:"runtime"`
+		Genres    []string   `json:"genres"`
+		Version   int32      `json:"version"`
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
+
+	err := json.Unmarshal(r.After, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	movie := &Movie{
+		ID:        snapshot.ID,
+		CreatedAt: snapshot.CreatedAt,
+		Title:     snapshot.Title,
+		Year:      snapshot.Year,
+		Runtime:   Runtime(snapshot.Runtime),
+		Genres:    snapshot.Genres,
+		Version:   snapshot.Version,
+		DeletedAt: snapshot.DeletedAt,
+	}
+
+	return movie, nil
+}
+
+func (m MovieModel) GetRevisions(movieID int64, filters Filters) ([]*MovieRevision, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), id, movie_id, version, action, before, after, user_id, created_at
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY version DESC, id DESC
+        LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Action,
+			&revision.Before,
+			&revision.After,
+			&revision.UserID,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, pageInfo, nil
+}
+
+func (m MovieModel) GetRevision(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+        SELECT id, movie_id, version, action, before, after, user_id, created_at
+        FROM movie_revisions
+        WHERE movie_id = $1 AND version = $2
+        ORDER BY id DESC
+        LIMIT 1
+	`
+
+	var revision MovieRevision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Action,
+		&revision.Before,
+		&revision.After,
+		&revision.UserID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// lockSnapshot locks the movie's row for the rest of the transaction, returning a snapshot of it
+// to record as the state before a change. Deleted movies are only found if includeDeleted is set.
+func lockSnapshot(ctx context.Context, tx *sql.Tx, movieID int64, includeDeleted bool) (string, error) {
+	query := `
+        SELECT to_jsonb(movies.*) - 'search_vector'
+        FROM movies
+        WHERE id = $1 AND (deleted_at IS NULL OR $2)
+        FOR UPDATE
+	`
+
+	var snapshot string
+
+	err := tx.QueryRowContext(ctx, query, movieID, includeDeleted).Scan(&snapshot)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// recordRevision adds the movie's current state to its history, and queues the matching webhook
+// event. It must be called in the same transaction as the change, so the history can never
+// disagree with the movie itself. A userID of zero records the change as made by an anonymous user.
+func recordRevision(ctx context.Context, tx *sql.Tx, movieID int64, action string, before *string, userID int64) error {
+	query := `
+        INSERT INTO movie_revisions (movie_id, version, action, before, after, user_id)
+        SELECT id, version, $2, $3, to_jsonb(movies.*) - 'search_vector', $4
+        FROM movies
+        WHERE id = $1
+        RETURNING version
+	`
+
+	actingUserID := sql.NullInt64{Int64: userID, Valid: userID != 0}
+
+	var version int32
+
+	err := tx.QueryRowContext(ctx, query, movieID, action, before, actingUserID).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	return enqueueEvent(ctx, tx, revisionEvents[action], map[string]any{"id": movieID, "version": version})
+}
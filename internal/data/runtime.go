@@ -25,18 +25,38 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 		return ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+	runtime, err := parseRuntimeMins(unquotedJSONValue)
+	if err != nil {
+		return err
+	}
+
+	*r = runtime
+
+	return nil
+}
+
+// ParseRuntime parses a runtime given either in the "102 mins" format used in JSON,
+// or as a plain number of minutes
+func ParseRuntime(s string) (Runtime, error) {
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err == nil {
+		return Runtime(i), nil
+	}
+
+	return parseRuntimeMins(s)
+}
+
+func parseRuntimeMins(s string) (Runtime, error) {
+	parts := strings.Split(s, " ")
 
 	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
 	i, err := strconv.ParseInt(parts[0], 10, 32)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(i)
-
-	return nil
+	return Runtime(i), nil
 }
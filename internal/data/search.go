@@ -0,0 +1,237 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	SearchModeWebsearch = "websearch"
+	SearchModePrefix    = "prefix"
+)
+
+// The stored search_vector column is built with the english configuration,
+// other languages are stemmed at query time so can't make use of its index
+const defaultSearchLanguage = "english"
+
+var (
+	SearchLanguages = []string{
+		"english", "simple", "danish", "dutch", "finnish", "french", "german",
+		"italian", "norwegian", "portuguese", "russian", "spanish", "swedish",
+	}
+
+	searchWordRX = regexp.MustCompile(`[\p{L}\p{N}]+`)
+)
+
+type MovieSearch struct {
+	Query    string
+	Language string
+	Mode     string
+}
+
+func (s MovieSearch) Validate(v *validator.Validator) {
+	v.Check(strings.TrimSpace(s.Query) != "", "q", "must be provided")
+	v.Check(len(s.Query) <= 500, "q", "must not be more than 500 bytes long")
+
+	v.Check(validator.PermittedValue(s.Language, SearchLanguages...), "language", "unsupported language")
+
+	v.Check(
+		validator.PermittedValue(s.Mode, SearchModeWebsearch, SearchModePrefix),
+		"mode",
+		"must be one of websearch or prefix",
+	)
+
+	if s.Mode == SearchModePrefix {
+		v.Check(len(searchWordRX.FindAllString(s.Query, -1)) > 0, "q", "must contain at least one word")
+	}
+}
+
+// tsquery returns the function used to build the tsquery and the text to pass to it.
+// Websearch mode supports "quoted phrases", OR and -exclusions, while prefix mode matches
+// every word as a prefix for search-as-you-type. Prefix queries are built from the words
+// alone, so users can't inject tsquery operators into them.
+func (s MovieSearch) tsquery() (string, string) {
+	if s.Mode == SearchModePrefix {
+		words := searchWordRX.FindAllString(s.Query, -1)
+		for i := range words {
+			words[i] = words[i] + ":*"
+		}
+
+		return "to_tsquery", strings.Join(words, " & ")
+	}
+
+	return "websearch_to_tsquery", s.Query
+}
+
+type SearchHighlights struct {
+	Title  string `json:"title"`
+	Genres string `json:"genres"`
+}
+
+type MovieSearchResult struct {
+	*Movie
+	Rank       float32          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+func (m MovieModel) Search(search MovieSearch, filters Filters) ([]*MovieSearchResult, PageInfo, error) {
+	args := queryArgs{}
+
+	language := args.add(search.Language) + "::regconfig"
+
+	vector := "search_vector"
+	if search.Language != defaultSearchLanguage {
+		vector = fmt.Sprintf(
+			"setweight(to_tsvector(%[1]s, title), 'A') || setweight(to_tsvector(%[1]s, immutable_array_to_string(genres, ' ')), 'B')",
+			language,
+		)
+	}
+
+	function, text := search.tsquery()
+	tsquery := fmt.Sprintf("%s(%s, %s)", function, language, args.add(text))
+
+	headlineOptions := "'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'"
+
+	query := fmt.Sprintf(`
+        SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, review_count, poster,
+            ts_rank(%[1]s, query) AS rank,
+            ts_headline(%[2]s, title, query, %[3]s),
+            ts_headline(%[2]s, array_to_string(genres, ', '), query, %[3]s)
+        FROM movies, %[4]s AS query
+        WHERE %[1]s @@ query AND deleted_at IS NULL
+        ORDER BY %[5]s
+        LIMIT %[6]s OFFSET %[7]s`,
+		vector,
+		language,
+		headlineOptions,
+		tsquery,
+		filters.orderBy(false),
+		args.add(filters.limit()),
+		args.add(filters.offset()),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*MovieSearchResult{}
+
+	for rows.Next() {
+		result := MovieSearchResult{Movie: &Movie{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&result.ID,
+			&result.CreatedAt,
+			&result.Title,
+			&result.Year,
+			&result.Runtime,
+			pq.Array(&result.Genres),
+			&result.Version,
+			&result.Rating,
+			&result.ReviewCount,
+			&result.Poster,
+			&result.Rank,
+			&result.Highlights.Title,
+			&result.Highlights.Genres,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return results, pageInfo, nil
+}
+
+type MovieSuggestion struct {
+	ID    int64   `json:"id"`
+	Title string  `json:"title"`
+	Score float32 `json:"score"`
+}
+
+// Suggest returns the titles best matching what a user has typed so far. Word similarity
+// is used rather than similarity so a partial title still scores highly against a long one.
+func (m MovieModel) Suggest(text string, limit int, threshold float64) ([]*MovieSuggestion, error) {
+	query := `
+        SELECT id, title, word_similarity($1, title) AS score
+        FROM movies
+        WHERE $1 <% title AND deleted_at IS NULL
+        ORDER BY score DESC, title ASC
+        LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.beginFuzzyTx(ctx, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Score)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// beginFuzzyTx starts a read only transaction with the pg_trgm thresholds set, so that the
+// % and <% operators, which can make use of the trigram index, match at the configured
+// similarity. The settings are local to the transaction so don't leak into the pool.
+func (m MovieModel) beginFuzzyTx(ctx context.Context, threshold float64) (*sql.Tx, error) {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT set_config('pg_trgm.similarity_threshold', $1, true),
+            set_config('pg_trgm.word_similarity_threshold', $1, true)
+	`
+
+	_, err = tx.ExecContext(ctx, query, strconv.FormatFloat(threshold, 'f', -1, 64))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
@@ -14,14 +14,21 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeEmailChange    = "email-change"
+	ScopePasswordReset  = "password-reset"
 )
 
+// TokenScopes holds every scope, for revoking all of a user's tokens
+var TokenScopes = []string{ScopeActivation, ScopeAuthentication, ScopeEmailChange, ScopePasswordReset}
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// Email is the address an email change token confirms the user owns
+	Email string `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -65,30 +72,73 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewTx creates a token in the transaction
+func (m TokenModel) NewTx(ctx context.Context, tx *sql.Tx, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertToken(ctx, tx, token)
+	return token, err
+}
+
+// NewEmailChange creates a token for confirming the user owns the address they're changing their
+// email to. Any earlier email change tokens are deleted, so only the latest address can be confirmed.
+func (m TokenModel) NewEmailChange(userID int64, ttl time.Duration, email string) (*Token, error) {
+	err := m.DeleteAllForUser(ScopeEmailChange, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Email = email
+
+	err = m.Insert(token)
+	return token, err
+}
+
 func (m TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertToken(ctx, m.DB, token)
+}
+
+func insertToken(ctx context.Context, db querier, token *Token) error {
 	query := `
-        INSERT INTO tokens (hash, user_id, expiry, scope)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO tokens (hash, user_id, expiry, scope, email)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''))
 	`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Email}
 
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return deleteAllTokensForUser(ctx, m.DB, scope, userID)
 }
 
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+// DeleteAllForUserTx deletes the user's tokens of the scope in the transaction
+func (m TokenModel) DeleteAllForUserTx(ctx context.Context, tx *sql.Tx, scope string, userID int64) error {
+	return deleteAllTokensForUser(ctx, tx, scope, userID)
+}
+
+func deleteAllTokensForUser(ctx context.Context, db querier, scope string, userID int64) error {
 	query := `
         DELETE FROM tokens
         WHERE scope = $1 AND user_id = $2
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	_, err := db.ExecContext(ctx, query, scope, userID)
 	return err
 }
@@ -0,0 +1,313 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+// Locales are a language, optionally followed by a script and a region, e.g. "fr", "pt-BR" or "zh-Hant-TW"
+var localeRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// Translation holds a movie's title in the language of a locale
+type Translation struct {
+	MovieID   int64     `json:"movieId"`
+	Locale    string    `json:"locale"`
+	CreatedAt time.Time `json:"-"`
+	Title     string    `json:"title"`
+}
+
+func (t Translation) Validate(v *validator.Validator) {
+	v.Check(ValidLocale(t.Locale), "locale", "must be a language tag such as fr or pt-BR")
+
+	v.Check(t.Title != "", "title", "must be provided")
+	v.Check(len(t.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+func ValidLocale(locale string) bool {
+	return localeRX.MatchString(locale)
+}
+
+// CanonicalLocale fixes the case of each part of a locale, as language tags are case insensitive,
+// so that "PT-br" and "pt-BR" are stored and matched as the same locale
+func CanonicalLocale(locale string) string {
+	parts := strings.Split(locale, "-")
+
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return language
+}
+
+// matchLocale returns the available locale that best matches the preferences, which are in order
+// of preference, or "" if none of them match. A preference matches its exact locale first, then
+// its language on its own, then the same language in any other region.
+func matchLocale(preferences, available []string) string {
+	sort.Strings(available)
+
+	for _, preference := range preferences {
+		if validator.PermittedValue(preference, available...) {
+			return preference
+		}
+
+		language := localeLanguage(preference)
+
+		if validator.PermittedValue(language, available...) {
+			return language
+		}
+
+		for _, locale := range available {
+			if localeLanguage(locale) == language {
+				return locale
+			}
+		}
+	}
+
+	return ""
+}
+
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// Put adds the translation, or replaces the movie's existing translation for the locale.
+// It returns whether the translation was created, or ErrRecordNotFound if the movie doesn't exist.
+// Movies are returned with their translated titles, so changing one is recorded as a new version
+// of the movie, unless the title is the same as before.
+func (m TranslationModel) Put(translation *Translation, userID int64) (bool, error) {
+	// xmax is only zero for a row that was inserted rather than updated
+	query := `
+        INSERT INTO movie_translations (movie_id, locale, title)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (movie_id, locale) DO UPDATE SET title = EXCLUDED.title
+        WHERE movie_translations.title <> EXCLUDED.title
+        RETURNING created_at, xmax = 0 AS created
+	`
+
+	args := []any{translation.MovieID, translation.Locale, translation.Title}
+
+	var created bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, translation.MovieID, false)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&translation.CreatedAt, &created)
+	if err != nil {
+		switch {
+		// Nothing is returned when the title hasn't changed
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	err = bumpMovieVersion(ctx, tx, translation.MovieID, &before, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return created, tx.Commit()
+}
+
+func (m TranslationModel) GetAllForMovie(movieID int64) ([]*Translation, error) {
+	query := `
+        SELECT movie_id, locale, created_at, title
+        FROM movie_translations
+        WHERE movie_id = $1
+        ORDER BY locale
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*Translation{}
+
+	for rows.Next() {
+		var translation Translation
+
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.CreatedAt, &translation.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		translations = append(translations, &translation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// Delete removes the movie's translation for the locale, which is recorded as a new version of the movie
+func (m TranslationModel) Delete(movieID int64, locale string, userID int64) error {
+	query := `
+        DELETE FROM movie_translations
+        WHERE movie_id = $1 AND locale = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSnapshot(ctx, tx, movieID, false)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, movieID, locale)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = bumpMovieVersion(ctx, tx, movieID, &before, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// bumpMovieVersion increments the version of a movie locked with lockSnapshot, for changes to what's
+// returned with the movie that aren't stored in its row, and records the change in its history
+func bumpMovieVersion(ctx context.Context, tx *sql.Tx, movieID int64, before *string, userID int64) error {
+	query := `
+        UPDATE movies
+        SET version = version + 1
+        WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, movieID)
+	if err != nil {
+		return err
+	}
+
+	return recordRevision(ctx, tx, movieID, RevisionActionUpdate, before, userID)
+}
+
+// Localize replaces each movie's title with its translation that best matches the preferred locales,
+// keeping the original title in OriginalTitle. Movies without a matching translation are left as they are.
+func (m TranslationModel) Localize(movies []*Movie, preferences []string) error {
+	if len(movies) == 0 || len(preferences) == 0 {
+		return nil
+	}
+
+	movieIDs := make([]int64, len(movies))
+	for i, movie := range movies {
+		movieIDs[i] = movie.ID
+	}
+
+	languages := make([]string, len(preferences))
+	for i, preference := range preferences {
+		languages[i] = localeLanguage(preference)
+	}
+
+	// Only translations in one of the preferred languages could be a match
+	query := `
+        SELECT movie_id, locale, title
+        FROM movie_translations
+        WHERE movie_id = ANY($1) AND split_part(locale, '-', 1) = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), pq.Array(languages))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	titles := make(map[int64]map[string]string)
+
+	for rows.Next() {
+		var movieID int64
+		var locale, title string
+
+		err := rows.Scan(&movieID, &locale, &title)
+		if err != nil {
+			return err
+		}
+
+		if titles[movieID] == nil {
+			titles[movieID] = make(map[string]string)
+		}
+
+		titles[movieID][locale] = title
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		available := make([]string, 0, len(titles[movie.ID]))
+		for locale := range titles[movie.ID] {
+			available = append(available, locale)
+		}
+
+		locale := matchLocale(preferences, available)
+		if locale == "" {
+			continue
+		}
+
+		movie.OriginalTitle = movie.Title
+		movie.Title = titles[movie.ID][locale]
+		movie.Locale = locale
+	}
+
+	return nil
+}
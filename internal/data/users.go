@@ -2,8 +2,10 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -15,16 +17,23 @@ var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 )
 
+var AnonymousUser = &User{}
+
 type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"createdAt"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
+	Locale    string    `json:"locale"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
 }
 
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
 // The plaintext field is a *pointer* to a string,
 // so that we're able to distinguish between a plaintext password not being present in
 // the struct at all, versus a plaintext password which is the empty string "".
@@ -45,6 +54,19 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Invalidate replaces the password with a random one nobody knows, so the user can't
+// authenticate until they've reset it
+func (p *password) Invalidate() error {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	return p.Set(hex.EncodeToString(randomBytes))
+}
+
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
@@ -65,6 +87,8 @@ func (user User) Validate(v *validator.Validator) {
 
 	ValidateEmail(v, user.Email)
 
+	v.Check(ValidLocale(user.Locale), "locale", "must be a valid locale such as en or pt-BR")
+
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
 	}
@@ -90,18 +114,27 @@ type UserModel struct {
 }
 
 func (m UserModel) Insert(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertUser(ctx, m.DB, user)
+}
+
+// InsertTx inserts the user in the transaction
+func (m UserModel) InsertTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	return insertUser(ctx, tx, user)
+}
+
+func insertUser(ctx context.Context, db querier, user *User) error {
 	query := `
-        INSERT INTO users (name, email, password_hash, activated)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, locale, password_hash, activated)
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version
 	`
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	args := []any{user.Name, user.Email, user.Locale, user.Password.hash, user.Activated}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		// TODO Better way of checking this?
@@ -115,9 +148,110 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getUser(ctx, m.DB, id)
+}
+
+// GetTx gets the user in the transaction
+func (m UserModel) GetTx(ctx context.Context, tx *sql.Tx, id int64) (*User, error) {
+	return getUser(ctx, tx, id)
+}
+
+func getUser(ctx context.Context, db querier, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, email, locale, password_hash, activated, version
+        FROM users
+        WHERE id = $1
+	`
+
+	var user User
+
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Locale,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetAll returns the users whose name or email contains the search, only including activated or
+// inactive users if activated isn't nil
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), id, created_at, name, email, locale, password_hash, activated, version
+        FROM users
+        WHERE ($1 = '' OR strpos(lower(name), lower($1)) > 0 OR strpos(lower(email::text), lower($1)) > 0)
+        AND ($2::boolean IS NULL OR activated = $2)
+        ORDER BY ` + filters.orderBy(false) + `
+        LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Locale,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return users, pageInfo, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, locale, password_hash, activated, version
         FROM users
         WHERE email = $1
 	`
@@ -132,6 +266,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
+		&user.Locale,
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
@@ -153,7 +288,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version
+        SELECT u.id, u.created_at, u.name, u.email, u.locale, u.password_hash, u.activated, u.version
         FROM users AS u
         INNER JOIN tokens
         ON u.id = tokens.user_id
@@ -174,6 +309,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
+		&user.Locale,
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
@@ -191,30 +327,81 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 }
 
 func (m UserModel) Update(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return updateUser(ctx, m.DB, user)
+}
+
+// UpdateTx updates the user in the transaction
+func (m UserModel) UpdateTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	return updateUser(ctx, tx, user)
+}
+
+func updateUser(ctx context.Context, db querier, user *User) error {
 	query := `
         UPDATE users
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, locale = $3, password_hash = $4, activated = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version
 	`
 
 	args := []any{
 		user.Name,
 		user.Email,
+		user.Locale,
 		user.Password.hash,
 		user.Activated,
 		user.ID,
 		user.Version,
 	}
 
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Activate marks the user as activated, queueing the user.activated webhook event in the same transaction
+func (m UserModel) Activate(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.ActivateTx(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ActivateTx marks the user as activated in the transaction, along with queueing the user.activated webhook event
+func (m UserModel) ActivateTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+        UPDATE users
+        SET activated = true, version = version + 1
+        WHERE id = $1 AND version = $2
+        RETURNING version
+	`
+
+	err := tx.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
@@ -222,5 +409,173 @@ func (m UserModel) Update(user *User) error {
 		}
 	}
 
+	err = enqueueEvent(ctx, tx, EventUserActivated, map[string]any{"id": user.ID})
+	if err != nil {
+		return err
+	}
+
+	user.Activated = true
+
 	return nil
 }
+
+// ChangeEmail sets the user's email to the address the email change token was sent to, returning
+// the user and the email they had before. The user's email change tokens are deleted in the same
+// transaction, so each token can only be used once.
+func (m UserModel) ChangeEmail(tokenPlaintext string) (*User, string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT u.id, u.created_at, u.name, u.email, u.locale, u.password_hash, u.activated, u.version, tokens.email
+        FROM users AS u
+        INNER JOIN tokens
+        ON u.id = tokens.user_id
+        WHERE tokens.hash = $1
+        AND tokens.scope = $2
+        AND tokens.expiry > $3
+        FOR UPDATE OF u
+	`
+
+	args := []any{tokenHash[:], ScopeEmailChange, time.Now()}
+
+	var user User
+	var email string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Locale,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&email,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+
+	query = `
+        UPDATE users
+        SET email = $1, version = version + 1
+        WHERE id = $2
+        RETURNING version
+	`
+
+	// Another user may have taken the address since the token was sent
+	err = tx.QueryRowContext(ctx, query, email, user.ID).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return nil, "", ErrDuplicateEmail
+		default:
+			return nil, "", err
+		}
+	}
+
+	query = `
+        DELETE FROM tokens
+        WHERE scope = $1 AND user_id = $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, ScopeEmailChange, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	previousEmail := user.Email
+	user.Email = email
+
+	return &user, previousEmail, tx.Commit()
+}
+
+// Delete removes the user, which deletes their tokens, permissions, reviews, lists and webhooks
+// and leaves the movie revisions they made without a user. The ratings of the movies they
+// reviewed are recalculated in the same transaction.
+func (m UserModel) Delete(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The movies are locked in id order, like lockMovieForReview does for a single movie,
+	// so their ratings aren't recalculated by a concurrent review in the meantime
+	query := `
+        SELECT movies.id
+        FROM movies
+        INNER JOIN reviews ON reviews.movie_id = movies.id
+        WHERE reviews.user_id = $1
+        ORDER BY movies.id
+        FOR UPDATE OF movies
+	`
+
+	rows, err := tx.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	movieIDs := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		movieIDs = append(movieIDs, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query = `
+        DELETE FROM users
+        WHERE id = $1 AND version = $2
+	`
+
+	result, err := tx.ExecContext(ctx, query, user.ID, user.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	for _, id := range movieIDs {
+		err = updateMovieRating(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
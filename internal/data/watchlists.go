@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieList is one of the lists users keep of movies. Its value is the name of the
+// table the list is stored in, so only the constants below should ever be used.
+type MovieList string
+
+const (
+	ListWatchlist MovieList = "watchlist"
+	ListWatched   MovieList = "watched"
+)
+
+type MovieListEntry struct {
+	Movie   *Movie    `json:"movie"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Add puts the movie on the user's list, returning whether it was added or already on there.
+// ErrRecordNotFound is returned if the movie doesn't exist.
+func (m WatchlistModel) Add(list MovieList, userID, movieID int64) (bool, error) {
+	query := fmt.Sprintf(`
+        WITH movie AS (
+            SELECT id FROM movies WHERE id = $2 AND deleted_at IS NULL
+        ), added AS (
+            INSERT INTO %s (user_id, movie_id)
+            SELECT $1, id FROM movie
+            ON CONFLICT DO NOTHING
+            RETURNING movie_id
+        )
+        SELECT EXISTS (SELECT 1 FROM movie), EXISTS (SELECT 1 FROM added)`,
+		list,
+	)
+
+	var found, added bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&found, &added)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		return false, ErrRecordNotFound
+	}
+
+	return added, nil
+}
+
+func (m WatchlistModel) Remove(list MovieList, userID, movieID int64) error {
+	query := fmt.Sprintf(`
+        DELETE FROM %s
+        WHERE user_id = $1 AND movie_id = $2`,
+		list,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) Get(list MovieList, userID, movieID int64) (*MovieListEntry, error) {
+	query := fmt.Sprintf(`
+        SELECT movies.id, movies.created_at, title, year, runtime, genres, version, rating, review_count, poster, list.added_at
+        FROM %s AS list
+        INNER JOIN movies ON movies.id = list.movie_id
+        WHERE list.user_id = $1 AND list.movie_id = $2 AND movies.deleted_at IS NULL`,
+		list,
+	)
+
+	entry := MovieListEntry{Movie: &Movie{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(
+		&entry.Movie.ID,
+		&entry.Movie.CreatedAt,
+		&entry.Movie.Title,
+		&entry.Movie.Year,
+		&entry.Movie.Runtime,
+		pq.Array(&entry.Movie.Genres),
+		&entry.Movie.Version,
+		&entry.Movie.Rating,
+		&entry.Movie.ReviewCount,
+		&entry.Movie.Poster,
+		&entry.AddedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+func (m WatchlistModel) GetAll(list MovieList, userID int64, filters Filters) ([]*MovieListEntry, PageInfo, error) {
+	// Movies are joined in a subquery so the sort and id tie-break aren't ambiguous
+	query := fmt.Sprintf(`
+        SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, rating, review_count, poster, added_at
+        FROM (
+            SELECT movies.*, list.added_at
+            FROM %s AS list
+            INNER JOIN movies ON movies.id = list.movie_id
+            WHERE list.user_id = $1 AND movies.deleted_at IS NULL
+        ) AS entries
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`,
+		list,
+		filters.orderBy(false),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*MovieListEntry{}
+
+	for rows.Next() {
+		entry := MovieListEntry{Movie: &Movie{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Version,
+			&entry.Movie.Rating,
+			&entry.Movie.ReviewCount,
+			&entry.Movie.Poster,
+			&entry.AddedAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, pageInfo, nil
+}
+
+// Contains returns which of the movies are on the user's list
+func (m WatchlistModel) Contains(list MovieList, userID int64, movieIDs []int64) (map[int64]bool, error) {
+	query := fmt.Sprintf(`
+        SELECT movie_id
+        FROM %s
+        WHERE user_id = $1 AND movie_id = ANY($2)`,
+		list,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contains := make(map[int64]bool, len(movieIDs))
+
+	for rows.Next() {
+		var movieID int64
+
+		err := rows.Scan(&movieID)
+		if err != nil {
+			return nil, err
+		}
+
+		contains[movieID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contains, nil
+}
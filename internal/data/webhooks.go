@@ -0,0 +1,480 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/validator"
+)
+
+const (
+	EventMovieCreated  = "movie.created"
+	EventMovieUpdated  = "movie.updated"
+	EventMovieDeleted  = "movie.deleted"
+	EventMovieRestored = "movie.restored"
+	EventUserActivated = "user.activated"
+)
+
+// WebhookEventTypes holds the events webhooks can subscribe to
+var WebhookEventTypes = []string{
+	EventMovieCreated, EventMovieUpdated, EventMovieDeleted, EventMovieRestored, EventUserActivated,
+}
+
+// revisionEvents maps the actions recorded in a movie's history to the event sent for them
+var revisionEvents = map[string]string{
+	RevisionActionInsert:  EventMovieCreated,
+	RevisionActionUpdate:  EventMovieUpdated,
+	RevisionActionDelete:  EventMovieDeleted,
+	RevisionActionRestore: EventMovieRestored,
+}
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	// Deliveries are failed once they've used up all of their attempts
+	DeliveryStatusFailed = "failed"
+)
+
+// Webhook subscribes a URL to events. The secret is used to sign each delivery, so it's
+// never sent back to clients.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    int64     `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+}
+
+func (w Webhook) Validate(v *validator.Validator) {
+	v.Check(w.URL != "", "url", "must be provided")
+	v.Check(len(w.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+
+	u, err := url.Parse(w.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+
+	// Hostnames can still resolve to internal addresses, which is caught when deliveries are sent
+	if err == nil {
+		host := strings.ToLower(u.Hostname())
+		ip := net.ParseIP(host)
+
+		internal := host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !PublicIP(ip))
+		v.Check(!internal, "url", "must not be a loopback, private, shared or link-local address")
+	}
+
+	v.Check(w.Secret != "", "secret", "must be provided")
+	v.Check(len(w.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(w.Secret) <= 256, "secret", "must not be more than 256 bytes long")
+
+	v.Check(w.Events != nil, "events", "must be provided")
+	v.Check(len(w.Events) >= 1, "events", "must contain at least 1 event")
+	v.Check(validator.Unique(w.Events), "events", "must not contain duplicate values")
+
+	for _, event := range w.Events {
+		v.Check(validator.PermittedValue(event, WebhookEventTypes...), "events", fmt.Sprintf("unknown event %q", event))
+	}
+}
+
+// sharedAddressSpace is the range carriers use for NAT (RFC 6598). It isn't reachable from the
+// internet, but can be routed to internal services, like the private ranges.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether webhooks may be sent to the IP, which they can't be if it's a
+// loopback, private, shared, link-local or unspecified address
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+}
+
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookDelivery tracks sending an event to a webhook, including any retries
+type WebhookDelivery struct {
+	ID             int64         `json:"id"`
+	WebhookID      int64         `json:"webhookId"`
+	Event          *WebhookEvent `json:"event"`
+	Status         string        `json:"status"`
+	Attempts       int32         `json:"attempts"`
+	NextAttemptAt  *time.Time    `json:"nextAttemptAt,omitempty"`
+	ResponseStatus *int32        `json:"responseStatus,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	DeliveredAt    *time.Time    `json:"deliveredAt,omitempty"`
+
+	// The webhook's URL and secret are only loaded for deliveries that are about to be sent
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// enqueueEvent writes the event to the outbox. It must be called in the same transaction as
+// the change it describes, so an event is only ever sent for changes that were committed.
+func enqueueEvent(ctx context.Context, tx *sql.Tx, eventType string, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO webhook_events (type, data)
+        VALUES ($1, $2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, eventType, string(js))
+	return err
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+        INSERT INTO webhooks (user_id, url, secret, events)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+	`
+
+	args := []any{webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.Events)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt)
+}
+
+// Get returns the webhook if it belongs to the user
+func (m WebhookModel) Get(id, userID int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, user_id, url, secret, events
+        FROM webhooks
+        WHERE id = $1 AND user_id = $2
+	`
+
+	var webhook Webhook
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.Events),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (m WebhookModel) GetAllForUser(userID int64) ([]*Webhook, error) {
+	query := `
+        SELECT id, created_at, user_id, url, secret, events
+        FROM webhooks
+        WHERE user_id = $1
+        ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		var webhook Webhook
+
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.Events),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes the webhook if it belongs to the user, along with its deliveries
+func (m WebhookModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM webhooks
+        WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the webhook's delivery log, most recent first
+func (m WebhookModel) GetDeliveries(webhookID int64, filters Filters) ([]*WebhookDelivery, PageInfo, error) {
+	query := `
+        SELECT COUNT(*) OVER(), webhook_deliveries.id, webhook_id, status, attempts, next_attempt_at,
+            response_status, error, webhook_deliveries.created_at, delivered_at,
+            webhook_events.id, webhook_events.type, webhook_events.created_at, webhook_events.data
+        FROM webhook_deliveries
+        INNER JOIN webhook_events ON webhook_events.id = webhook_deliveries.event_id
+        WHERE webhook_id = $1
+        ORDER BY webhook_deliveries.id DESC
+        LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		delivery := WebhookDelivery{Event: &WebhookEvent{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.ResponseStatus,
+			&delivery.Error,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+			&delivery.Event.ID,
+			&delivery.Event.Type,
+			&delivery.Event.CreatedAt,
+			&delivery.Event.Data,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		// Only pending deliveries are going to be attempted again
+		if delivery.Status != DeliveryStatusPending {
+			delivery.NextAttemptAt = nil
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	pageInfo := calculatePageInfo(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, pageInfo, nil
+}
+
+// DispatchEvents fans events out of the outbox into a delivery for each webhook subscribed to
+// them, returning how many events were dispatched. Events are locked while being dispatched,
+// so several instances of the API can dispatch at the same time without sending duplicates.
+func (m WebhookModel) DispatchEvents(limit int) (int64, error) {
+	query := `
+        WITH events AS (
+            SELECT id, type
+            FROM webhook_events
+            WHERE dispatched_at IS NULL
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        ), deliveries AS (
+            INSERT INTO webhook_deliveries (webhook_id, event_id)
+            SELECT webhooks.id, events.id
+            FROM events
+            INNER JOIN webhooks ON events.type = ANY(webhooks.events)
+            ON CONFLICT DO NOTHING
+        )
+        UPDATE webhook_events
+        SET dispatched_at = NOW()
+        FROM events
+        WHERE webhook_events.id = events.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ClaimDelivery takes the next delivery that's due to be attempted, returning ErrRecordNotFound
+// if there aren't any. The delivery is pushed back by the lease, so if the attempt never gets
+// recorded, say because the API crashed, it's retried once the lease runs out.
+func (m WebhookModel) ClaimDelivery(lease time.Duration) (*WebhookDelivery, error) {
+	query := `
+        WITH due AS (
+            SELECT id
+            FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt_at <= $1
+            ORDER BY next_attempt_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        ), claimed AS (
+            UPDATE webhook_deliveries
+            SET attempts = attempts + 1, next_attempt_at = $2
+            FROM due
+            WHERE webhook_deliveries.id = due.id
+            RETURNING webhook_deliveries.*
+        )
+        SELECT claimed.id, claimed.webhook_id, claimed.status, claimed.attempts, claimed.created_at,
+            webhook_events.id, webhook_events.type, webhook_events.created_at, webhook_events.data,
+            webhooks.url, webhooks.secret
+        FROM claimed
+        INNER JOIN webhook_events ON webhook_events.id = claimed.event_id
+        INNER JOIN webhooks ON webhooks.id = claimed.webhook_id
+	`
+
+	delivery := WebhookDelivery{Event: &WebhookEvent{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	err := m.DB.QueryRowContext(ctx, query, now, now.Add(lease)).Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.CreatedAt,
+		&delivery.Event.ID,
+		&delivery.Event.Type,
+		&delivery.Event.CreatedAt,
+		&delivery.Event.Data,
+		&delivery.URL,
+		&delivery.Secret,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &delivery, nil
+}
+
+// DeleteFinishedEvents deletes events dispatched longer ago than the retention period, along with
+// their deliveries, once none of the deliveries are still pending. It returns how many were deleted.
+func (m WebhookModel) DeleteFinishedEvents(retention time.Duration) (int64, error) {
+	query := `
+        DELETE FROM webhook_events
+        WHERE dispatched_at < $1
+        AND NOT EXISTS (
+            SELECT 1
+            FROM webhook_deliveries
+            WHERE webhook_deliveries.event_id = webhook_events.id AND webhook_deliveries.status = 'pending'
+        )
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// RecordAttempt saves the outcome of attempting the delivery. Failed deliveries are retried
+// at retryAt, unless retryAt is nil, which means the delivery has no attempts left.
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery, retryAt *time.Time) error {
+	query := `
+        UPDATE webhook_deliveries
+        SET status = $1, response_status = $2, error = $3, next_attempt_at = COALESCE($4, next_attempt_at),
+            delivered_at = CASE WHEN $1 = 'succeeded' THEN NOW() END
+        WHERE id = $5
+	`
+
+	switch {
+	case delivery.Error == "":
+		delivery.Status = DeliveryStatusSucceeded
+	case retryAt != nil:
+		delivery.Status = DeliveryStatusPending
+	default:
+		delivery.Status = DeliveryStatusFailed
+	}
+
+	args := []any{delivery.Status, delivery.ResponseStatus, delivery.Error, retryAt, delivery.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
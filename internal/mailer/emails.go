@@ -0,0 +1,49 @@
+package mailer
+
+// Email is the data for one of the email templates. Each template has its own type, so
+// the data it's rendered with is checked when compiling rather than when sending.
+type Email interface {
+	TemplateName() string
+}
+
+type UserWelcome struct {
+	Name            string
+	ActivationToken string
+}
+
+func (UserWelcome) TemplateName() string { return "user_welcome" }
+
+// EmailChangeConfirmation is sent to the address a user is changing their email to
+type EmailChangeConfirmation struct {
+	Name  string
+	Email string
+	Token string
+}
+
+func (EmailChangeConfirmation) TemplateName() string { return "email_change_confirmation" }
+
+// EmailChanged is sent to a user's previous address once they've changed their email
+type EmailChanged struct {
+	Name  string
+	Email string
+}
+
+func (EmailChanged) TemplateName() string { return "email_changed" }
+
+// PasswordReset is sent when a user's password has been reset, with the token for choosing a new one
+type PasswordReset struct {
+	Name  string
+	Token string
+}
+
+func (PasswordReset) TemplateName() string { return "password_reset" }
+
+// examples holds an example of every email. Each template is rendered with its example at
+// startup, so a template using data its type doesn't have fails straight away, and the
+// examples are what the preview endpoint renders.
+var examples = []Email{
+	UserWelcome{Name: "Alice", ActivationToken: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"},
+	EmailChangeConfirmation{Name: "Alice", Email: "alice@example.com", Token: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"},
+	EmailChanged{Name: "Alice", Email: "alice@example.com"},
+	PasswordReset{Name: "Alice", Token: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU"},
+}
@@ -1,72 +1,89 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"embed"
-	"html/template"
-	"path/filepath"
-	"time"
-
-	"github.com/go-mail/mail/v2"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
+// Message is a rendered email, ready to be sent by a Transport
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	transport Transport
+	sender    string
+	templates templates
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+// New parses and checks every template, returning an error if any of them can't be rendered
+func New(transport Transport, sender string) (Mailer, error) {
+	templates, err := loadTemplates(templateFS)
+	if err != nil {
+		return Mailer{}, err
+	}
 
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
+	mailer := Mailer{
+		transport: transport,
+		sender:    sender,
+		templates: templates,
 	}
+
+	return mailer, nil
 }
 
-func (mailer Mailer) Send(recipient, templateFile string, data any) error {
-	path := filepath.Join("templates", templateFile)
-	tmpl, err := template.New("email").ParseFS(templateFS, path)
+// Send renders the email in the recipient's locale, or the closest one it's been translated to
+func (mailer Mailer) Send(ctx context.Context, recipient, locale string, email Email) error {
+	msg, err := mailer.render(email.TemplateName(), locale, email)
 	if err != nil {
 		return err
 	}
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
+	msg.To = recipient
+
+	// Failures aren't retried here, emails are sent from jobs which are retried with backoff
+	return mailer.transport.Send(ctx, msg)
+}
+
+// Preview renders the template's example email, returning ErrUnknownTemplate if there is no such template
+func (mailer Mailer) Preview(name, locale string) (*Message, error) {
+	for _, example := range examples {
+		if example.TemplateName() == name {
+			return mailer.render(name, locale, example)
+		}
 	}
 
-	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	return nil, ErrUnknownTemplate
+}
+
+func (mailer Mailer) render(name, locale string, email Email) (*Message, error) {
+	set, err := mailer.templates.lookup(name, locale)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	msg, err := set.render(email)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", mailer.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	for i := 1; i <= 3; i++ {
-		err = mailer.dialer.DialAndSend(msg)
-		if err == nil {
-			return nil
-		}
-		time.Sleep(500 * time.Millisecond)
+	msg.From = mailer.sender
+
+	return msg, nil
+}
+
+// Ping checks the transport is able to send emails, for transports that depend on a server
+func (mailer Mailer) Ping(ctx context.Context) error {
+	if pinger, ok := mailer.transport.(interface{ Ping(context.Context) error }); ok {
+		return pinger.Ping(ctx)
 	}
 
-	return err
+	return nil
 }
@@ -0,0 +1,183 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used for users whose locale doesn't have a translation of an email.
+// Every email must have a template in the default locale.
+const DefaultLocale = "en"
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Templates live in a directory for each locale, e.g. templates/fr/user_welcome.tmpl. Files in
+// templates/layouts and templates/partials are shared by every template. Each template defines
+// "subject", "plainBody" and "htmlContent", which the layout wraps into "htmlBody".
+const (
+	layoutsDir  = "layouts"
+	partialsDir = "partials"
+)
+
+// templateSet holds a template parsed for both plain text and HTML, so the subject and plain
+// text body aren't HTML escaped
+type templateSet struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates holds the parsed templates by locale and then name
+type templates map[string]map[string]*templateSet
+
+func loadTemplates(fsys fs.FS) (templates, error) {
+	shared := []string{}
+
+	for _, dir := range []string{layoutsDir, partialsDir} {
+		matches, err := fs.Glob(fsys, path.Join("templates", dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		shared = append(shared, matches...)
+	}
+
+	entries, err := fs.ReadDir(fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := templates{}
+
+	for _, entry := range entries {
+		locale := entry.Name()
+		if !entry.IsDir() || locale == layoutsDir || locale == partialsDir {
+			continue
+		}
+
+		files, err := fs.Glob(fsys, path.Join("templates", locale, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		t[locale] = map[string]*templateSet{}
+
+		for _, file := range files {
+			set, err := parseTemplate(fsys, locale, append([]string{file}, shared...))
+			if err != nil {
+				return nil, err
+			}
+
+			t[locale][strings.TrimSuffix(path.Base(file), ".tmpl")] = set
+		}
+	}
+
+	return t, t.check()
+}
+
+func parseTemplate(fsys fs.FS, locale string, files []string) (*templateSet, error) {
+	funcs := map[string]any{
+		"locale": func() string { return locale },
+	}
+
+	// Missing map keys are errors rather than rendering as "<no value>"
+	text, err := texttemplate.New("email").Option("missingkey=error").Funcs(funcs).ParseFS(fsys, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := htmltemplate.New("email").Option("missingkey=error").Funcs(funcs).ParseFS(fsys, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateSet{text: text, html: html}, nil
+}
+
+// check renders every template with its example, and makes sure every email has a template in
+// the default locale and every template has an email type, so mistakes are found at startup
+func (t templates) check() error {
+	if _, ok := t[DefaultLocale]; !ok {
+		return fmt.Errorf("no templates for the default locale %q", DefaultLocale)
+	}
+
+	names := map[string]bool{}
+
+	for _, example := range examples {
+		name := example.TemplateName()
+		names[name] = true
+
+		if _, ok := t[DefaultLocale][name]; !ok {
+			return fmt.Errorf("no %s template for the default locale %q", name, DefaultLocale)
+		}
+	}
+
+	for locale, sets := range t {
+		for name := range sets {
+			if !names[name] {
+				return fmt.Errorf("template %s/%s has no email type", locale, name)
+			}
+		}
+
+		for _, example := range examples {
+			set, ok := sets[example.TemplateName()]
+			if !ok {
+				continue
+			}
+
+			_, err := set.render(example)
+			if err != nil {
+				return fmt.Errorf("template %s/%s: %w", locale, example.TemplateName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the template for the locale, falling back to the locale's language on its
+// own and then to the default locale
+func (t templates) lookup(name, locale string) (*templateSet, error) {
+	language, _, _ := strings.Cut(locale, "-")
+
+	for _, candidate := range []string{locale, language, DefaultLocale} {
+		if set, ok := t[candidate][name]; ok {
+			return set, nil
+		}
+	}
+
+	return nil, ErrUnknownTemplate
+}
+
+func (s *templateSet) render(email Email) (*Message, error) {
+	subject := new(bytes.Buffer)
+	err := s.text.ExecuteTemplate(subject, "subject", email)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = s.text.ExecuteTemplate(plainBody, "plainBody", email)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = s.html.ExecuteTemplate(htmlBody, "htmlBody", email)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Subject:   strings.TrimSpace(subject.String()),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}
+
+	return msg, nil
+}
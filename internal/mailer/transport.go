@@ -0,0 +1,163 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+	"github.com/mymorkkis/lets-go-further-json-api/internal/jsonlog"
+)
+
+// Transport delivers rendered emails, keeping how they're delivered separate from rendering them
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// mimeMessage builds the MIME message for the email, with the HTML body as an alternative to the plain text one
+func (msg *Message) mimeMessage() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	return m
+}
+
+// SMTPTransport sends emails through an SMTP server
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+// Send gives up once the context is done. The SMTP client doesn't take a context, so the time
+// left before its deadline is used as the timeout for each step of sending instead.
+func (t *SMTPTransport) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dialer := *t.dialer
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < dialer.Timeout {
+			dialer.Timeout = remaining
+		}
+	}
+
+	return dialer.DialAndSend(msg.mimeMessage())
+}
+
+// Ping checks that the SMTP server is accepting connections, without authenticating or sending anything
+func (t *SMTPTransport) Ping(ctx context.Context) error {
+	address := net.JoinHostPort(t.dialer.Host, strconv.Itoa(t.dialer.Port))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// DirTransport writes each email to a .eml file in a directory, which most mail clients can open
+type DirTransport struct {
+	dir string
+}
+
+func NewDirTransport(dir string) (*DirTransport, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirTransport{dir: dir}, nil
+}
+
+func (t *DirTransport) Send(ctx context.Context, msg *Message) error {
+	suffix := make([]byte, 4)
+
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+
+	// Names start with the time they were sent, so listing the directory shows them in order
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000"), hex.EncodeToString(suffix))
+
+	file, err := os.Create(filepath.Join(t.dir, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.mimeMessage().WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// LogTransport only logs emails, including their plain text body, instead of sending them
+type LogTransport struct {
+	logger *jsonlog.Logger
+}
+
+func NewLogTransport(logger *jsonlog.Logger) *LogTransport {
+	return &LogTransport{logger: logger}
+}
+
+func (t *LogTransport) Send(ctx context.Context, msg *Message) error {
+	t.logger.PrintInfo("email not sent, logged instead", map[string]string{
+		"from":    msg.From,
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.PlainBody,
+	})
+
+	return nil
+}
+
+// MemoryTransport keeps the emails it's given, so tests can check what would have been sent
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, msg)
+
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (t *MemoryTransport) Messages() []*Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*Message{}, t.messages...)
+}
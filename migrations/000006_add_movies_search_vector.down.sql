@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_search_vector_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS immutable_array_to_string(text[], text);
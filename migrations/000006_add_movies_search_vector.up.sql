@@ -0,0 +1,12 @@
+-- array_to_string is only STABLE, so it can't be used directly in a generated column
+CREATE OR REPLACE FUNCTION immutable_array_to_string(text[], text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+    AS $$ SELECT array_to_string($1, $2) $$;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', immutable_array_to_string(genres, ' ')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_search_vector_idx ON movies
+    USING GIN (search_vector);
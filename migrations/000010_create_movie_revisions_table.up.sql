@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    before jsonb,
+    after jsonb NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_version_idx ON movie_revisions (movie_id, version);
+
+-- Movies created before revisions were recorded start their history from how they are now
+INSERT INTO movie_revisions (movie_id, version, action, after, created_at)
+SELECT id, version, 'insert', to_jsonb(movies.*) - 'search_vector', created_at
+FROM movies;
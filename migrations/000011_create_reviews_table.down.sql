@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS movies_rating_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS review_count;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating;
+
+DROP TABLE IF EXISTS reviews;
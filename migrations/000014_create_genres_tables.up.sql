@@ -0,0 +1,84 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL
+);
+
+-- Aliases are stored in slug form, the same as the input they're matched against
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+INSERT INTO genres (slug, name)
+VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('animation', 'Animation'),
+    ('biography', 'Biography'),
+    ('comedy', 'Comedy'),
+    ('crime', 'Crime'),
+    ('documentary', 'Documentary'),
+    ('drama', 'Drama'),
+    ('family', 'Family'),
+    ('fantasy', 'Fantasy'),
+    ('history', 'History'),
+    ('horror', 'Horror'),
+    ('music', 'Music'),
+    ('musical', 'Musical'),
+    ('mystery', 'Mystery'),
+    ('romance', 'Romance'),
+    ('science-fiction', 'Science Fiction'),
+    ('sport', 'Sport'),
+    ('thriller', 'Thriller'),
+    ('war', 'War'),
+    ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT aliases.alias, genres.id
+FROM (
+    VALUES
+        ('animated', 'animation'),
+        ('biopic', 'biography'),
+        ('doc', 'documentary'),
+        ('historical', 'history'),
+        ('romantic', 'romance'),
+        ('sci-fi', 'science-fiction'),
+        ('scifi', 'science-fiction'),
+        ('sf', 'science-fiction'),
+        ('sports', 'sport')
+) AS aliases (alias, slug)
+INNER JOIN genres ON genres.slug = aliases.slug
+ON CONFLICT DO NOTHING;
+
+-- Genres already used by movies that aren't covered above are kept, becoming genres of their own
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, initcap(trim(genre))
+FROM (
+    SELECT genre, trim(BOTH '-' FROM regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g')) AS slug
+    FROM movies, unnest(movies.genres) AS genre
+) AS used
+WHERE slug <> ''
+AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE alias = used.slug)
+ORDER BY slug, genre
+ON CONFLICT DO NOTHING;
+
+-- Every genre is then replaced by its canonical slug, dropping any duplicates that creates
+UPDATE movies
+SET genres = normalized.genres
+FROM (
+    SELECT id, array_agg(slug ORDER BY position) AS genres
+    FROM (
+        SELECT DISTINCT ON (movies.id, genres.slug) movies.id, genres.slug, genre.position
+        FROM movies, unnest(movies.genres) WITH ORDINALITY AS genre (name, position)
+        INNER JOIN genres ON genres.slug = trim(BOTH '-' FROM regexp_replace(lower(genre.name), '[^a-z0-9]+', '-', 'g'))
+            OR genres.id = (
+                SELECT genre_id FROM genre_aliases
+                WHERE alias = trim(BOTH '-' FROM regexp_replace(lower(genre.name), '[^a-z0-9]+', '-', 'g'))
+            )
+        ORDER BY movies.id, genres.slug, genre.position
+    ) AS resolved
+    GROUP BY id
+) AS normalized
+WHERE movies.id = normalized.id AND movies.genres IS DISTINCT FROM normalized.genres;
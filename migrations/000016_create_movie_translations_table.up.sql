@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    PRIMARY KEY (movie_id, locale)
+);
+
+-- Searches match translated titles the same way they match the original title
+CREATE INDEX IF NOT EXISTS movie_translations_title_tsvector_idx ON movie_translations
+    USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movie_translations_title_trgm_idx ON movie_translations
+    USING GIN (title gin_trgm_ops);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'users:manage';
+
+DROP TABLE IF EXISTS audit_log;